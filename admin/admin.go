@@ -0,0 +1,408 @@
+// Package admin provides an HTTP/JSON API for inspecting and managing an
+// at.At scheduler.
+//
+// The handler serves the following routes, relative to where it is mounted:
+//
+//	GET    /jobs                 list pending jobs, optionally ?queue=name&selector=k=v
+//	POST   /jobs                 submit a registered job by name
+//	DELETE /jobs?selector=k=v    cancel the pending jobs matching a selector
+//	GET    /jobs/{id}            get a pending job
+//	DELETE /jobs/{id}            cancel a pending job
+//	POST   /jobs/{id}/reschedule move a pending job to a new time
+//	GET    /results              recent job results, newest first
+//	GET    /healthz              liveness
+//	GET    /readyz               readiness, ok while the scheduler runs
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotoxu/at"
+)
+
+// JobFactory builds a job from the JSON arguments of a submission.
+type JobFactory func(args json.RawMessage) (at.Job, error)
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithResults sets how many recent job results are kept. The default is 100.
+func WithResults(n int) Option {
+	return func(h *Handler) {
+		h.size = n
+	}
+}
+
+// eventBuffer is the number of events buffered while results are collected.
+const eventBuffer = 256
+
+// Handler is an http.Handler exposing an at.At.
+type Handler struct {
+	at  *at.At
+	mux *http.ServeMux
+
+	mu        sync.RWMutex
+	factories map[string]JobFactory
+
+	size    int
+	results []Result
+	sub     *at.Subscription
+	done    chan struct{}
+}
+
+// NewHandler returns a Handler for a. Call Close to release it.
+func NewHandler(a *at.At, opts ...Option) *Handler {
+	h := &Handler{
+		at:        a,
+		mux:       http.NewServeMux(),
+		factories: make(map[string]JobFactory),
+		size:      100,
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux.HandleFunc("/jobs", h.jobs)
+	h.mux.HandleFunc("/jobs/", h.job)
+	h.mux.HandleFunc("/results", allow("GET", h.listResults))
+	h.mux.HandleFunc("/healthz", allow("GET", h.healthz))
+	h.mux.HandleFunc("/readyz", allow("GET", h.readyz))
+
+	h.sub = a.Subscribe(eventBuffer)
+	go h.collect()
+	return h
+}
+
+// Register makes a job factory available for submission under name.
+func (h *Handler) Register(name string, f JobFactory) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.factories[name] = f
+}
+
+// Close stops collecting job results.
+func (h *Handler) Close() {
+	h.sub.Close()
+	<-h.done
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Job is the JSON representation of a pending job.
+type Job struct {
+	ID     at.EntryID      `json:"id"`
+	At     time.Time       `json:"at"`
+	Queue  string          `json:"queue"`
+	Labels at.Labels       `json:"labels,omitempty"`
+	Key    string          `json:"key,omitempty"`
+	Name   string          `json:"name,omitempty"`
+	Args   json.RawMessage `json:"args,omitempty"`
+}
+
+// Result is the JSON representation of a finished job.
+type Result struct {
+	ID       at.EntryID `json:"id"`
+	Status   string     `json:"status"`
+	At       time.Time  `json:"at"`
+	Finished time.Time  `json:"finished"`
+	Duration string     `json:"duration"`
+	Error    string     `json:"error,omitempty"`
+}
+
+type submission struct {
+	Name   string          `json:"name"`
+	Args   json.RawMessage `json:"args"`
+	At     time.Time       `json:"at"`
+	Queue  string          `json:"queue"`
+	Labels at.Labels       `json:"labels"`
+}
+
+type reschedule struct {
+	At time.Time `json:"at"`
+}
+
+// namedJob remembers which factory built a job so that it can be listed.
+type namedJob struct {
+	at.Job
+	name string
+	args json.RawMessage
+}
+
+// RunErr forwards to the built job so that its errors are still reported.
+func (j namedJob) RunErr() error {
+	if ej, ok := j.Job.(at.ErrJob); ok {
+		return ej.RunErr()
+	}
+
+	j.Job.Run()
+	return nil
+}
+
+func newJob(e at.Entry) Job {
+	j := Job{ID: e.ID, At: e.At, Queue: e.Queue, Labels: e.Labels, Key: e.Key}
+	if nj, ok := e.Job.(namedJob); ok {
+		j.Name = nj.name
+		j.Args = nj.args
+	}
+
+	return j
+}
+
+func (h *Handler) jobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.listJobs(w, r)
+	case http.MethodPost:
+		h.submitJob(w, r)
+	case http.MethodDelete:
+		h.cancelJobs(w, r)
+	default:
+		methodNotAllowed(w, "GET, POST, DELETE")
+	}
+}
+
+// job routes /jobs/{id} and /jobs/{id}/reschedule.
+func (h *Handler) job(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid id %q", parts[0]))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		h.getJob(w, r, at.EntryID(id))
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		h.cancelJob(w, r, at.EntryID(id))
+	case len(parts) == 1:
+		methodNotAllowed(w, "GET, DELETE")
+	case len(parts) == 2 && parts[1] == "reschedule" && r.Method == http.MethodPost:
+		h.rescheduleJob(w, r, at.EntryID(id))
+	case len(parts) == 2 && parts[1] == "reschedule":
+		methodNotAllowed(w, "POST")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) listJobs(w http.ResponseWriter, r *http.Request) {
+	sel, err := at.ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	queue := r.URL.Query().Get("queue")
+	jobs := []Job{}
+	for _, e := range h.at.EntriesWhere(sel) {
+		if queue != "" && e.Queue != queue {
+			continue
+		}
+		jobs = append(jobs, newJob(e))
+	}
+
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (h *Handler) cancelJobs(w http.ResponseWriter, r *http.Request) {
+	selector := r.URL.Query().Get("selector")
+	if selector == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing selector"))
+		return
+	}
+	sel, err := at.ParseSelector(selector)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ids := h.at.CancelWhere(sel)
+	if ids == nil {
+		ids = []at.EntryID{}
+	}
+	writeJSON(w, http.StatusOK, map[string][]at.EntryID{"cancelled": ids})
+}
+
+func (h *Handler) submitJob(w http.ResponseWriter, r *http.Request) {
+	var s submission
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if s.At.IsZero() {
+		writeError(w, http.StatusBadRequest, errors.New("missing at"))
+		return
+	}
+
+	h.mu.RLock()
+	f, ok := h.factories[s.Name]
+	h.mu.RUnlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown job %q", s.Name))
+		return
+	}
+
+	job, err := f(s.Args)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if s.Queue == "" {
+		s.Queue = at.DefaultQueue
+	}
+	id, err := h.at.AddJob(s.At, namedJob{Job: job, name: s.Name, args: s.Args}, at.InQueue(s.Queue), at.WithLabels(s.Labels))
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	e, ok := h.at.Entry(id)
+	if !ok {
+		// The job is already running.
+		writeJSON(w, http.StatusCreated, Job{ID: id, At: s.At, Queue: s.Queue, Labels: s.Labels, Name: s.Name, Args: s.Args})
+		return
+	}
+	writeJSON(w, http.StatusCreated, newJob(e))
+}
+
+func (h *Handler) getJob(w http.ResponseWriter, r *http.Request, id at.EntryID) {
+	e, ok := h.at.Entry(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, errNotPending)
+		return
+	}
+	writeJSON(w, http.StatusOK, newJob(e))
+}
+
+func (h *Handler) cancelJob(w http.ResponseWriter, r *http.Request, id at.EntryID) {
+	if !h.at.Cancel(id) {
+		writeError(w, http.StatusNotFound, errNotPending)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) rescheduleJob(w http.ResponseWriter, r *http.Request, id at.EntryID) {
+	var rs reschedule
+	if err := json.NewDecoder(r.Body).Decode(&rs); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if rs.At.IsZero() {
+		writeError(w, http.StatusBadRequest, errors.New("missing at"))
+		return
+	}
+
+	if !h.at.Reschedule(id, rs.At) {
+		writeError(w, http.StatusNotFound, errNotPending)
+		return
+	}
+
+	e, ok := h.at.Entry(id)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, newJob(e))
+}
+
+func (h *Handler) listResults(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	results := make([]Result, 0, len(h.results))
+	for i := len(h.results) - 1; i >= 0; i-- {
+		results = append(results, h.results[i])
+	}
+	h.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (h *Handler) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	if !h.at.Running() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "stopped"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "running"})
+}
+
+// collect records the outcome of every finished job.
+func (h *Handler) collect() {
+	defer close(h.done)
+
+	for ev := range h.sub.C {
+		switch ev.Type {
+		case at.Succeeded, at.Failed, at.Panicked, at.Missed:
+		default:
+			continue
+		}
+
+		res := Result{
+			ID:       ev.EntryID,
+			Status:   ev.Type.String(),
+			At:       ev.At,
+			Finished: ev.Time,
+			Duration: ev.Duration.String(),
+		}
+		if ev.Err != nil {
+			res.Error = ev.Err.Error()
+		} else if ev.Panic != nil {
+			res.Error = fmt.Sprint(ev.Panic)
+		}
+
+		h.mu.Lock()
+		if h.size <= 0 {
+			h.mu.Unlock()
+			continue
+		}
+		if len(h.results) == h.size {
+			copy(h.results, h.results[1:])
+			h.results = h.results[:len(h.results)-1]
+		}
+		h.results = append(h.results, res)
+		h.mu.Unlock()
+	}
+}
+
+var errNotPending = errors.New("job not pending")
+
+func allow(method string, f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			methodNotAllowed(w, method)
+			return
+		}
+		f(w, r)
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,141 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+	"github.com/gotoxu/at"
+)
+
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+func TestSubmitListCancel(t *testing.T) {
+	a := at.New()
+	h := NewHandler(a)
+	defer h.Close()
+	h.Register("greet", func(args json.RawMessage) (at.Job, error) {
+		var name string
+		if err := json.Unmarshal(args, &name); err != nil {
+			return nil, err
+		}
+		return at.FuncJob(func() {}), nil
+	})
+
+	when := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	rec := do(h, "POST", "/jobs", `{"name":"greet","args":"bob","at":"`+when+`","queue":"mail"}`)
+	assert.DeepEqual(t, rec.Code, http.StatusCreated)
+
+	var job Job
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &job))
+	assert.DeepEqual(t, job.Name, "greet")
+	assert.DeepEqual(t, job.Queue, "mail")
+	assert.DeepEqual(t, string(job.Args), `"bob"`)
+
+	var jobs []Job
+	rec = do(h, "GET", "/jobs?queue=mail", "")
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &jobs))
+	assert.Len(t, jobs, 1)
+	assert.DeepEqual(t, jobs[0].ID, job.ID)
+
+	rec = do(h, "GET", "/jobs?queue=other", "")
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &jobs))
+	assert.Len(t, jobs, 0)
+
+	path := "/jobs/" + jsonNumber(job.ID)
+	assert.DeepEqual(t, do(h, "GET", path, "").Code, http.StatusOK)
+	assert.DeepEqual(t, do(h, "DELETE", path, "").Code, http.StatusNoContent)
+	assert.DeepEqual(t, do(h, "GET", path, "").Code, http.StatusNotFound)
+}
+
+func TestSubmitErrors(t *testing.T) {
+	a := at.New()
+	h := NewHandler(a)
+	defer h.Close()
+	h.Register("bad", func(json.RawMessage) (at.Job, error) {
+		return nil, errors.New("bad args")
+	})
+
+	when := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	assert.DeepEqual(t, do(h, "POST", "/jobs", `{"name":"missing","at":"`+when+`"}`).Code, http.StatusNotFound)
+	assert.DeepEqual(t, do(h, "POST", "/jobs", `{"name":"bad","at":"`+when+`"}`).Code, http.StatusBadRequest)
+	assert.DeepEqual(t, do(h, "POST", "/jobs", `{"name":"bad"}`).Code, http.StatusBadRequest)
+	assert.DeepEqual(t, do(h, "GET", "/jobs/abc", "").Code, http.StatusBadRequest)
+}
+
+func TestReschedule(t *testing.T) {
+	a := at.New()
+	h := NewHandler(a)
+	defer h.Close()
+
+	id, _ := a.AddFunc(time.Now().Add(time.Hour), func() {})
+	when := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+	rec := do(h, "POST", "/jobs/"+jsonNumber(id)+"/reschedule", `{"at":"`+when.Format(time.RFC3339)+`"}`)
+	assert.DeepEqual(t, rec.Code, http.StatusOK)
+
+	e, ok := a.Entry(id)
+	assert.True(t, ok)
+	assert.True(t, e.At.Equal(when))
+}
+
+func TestResultsAndHealth(t *testing.T) {
+	a := at.New()
+	h := NewHandler(a)
+	defer h.Close()
+
+	assert.DeepEqual(t, do(h, "GET", "/healthz", "").Code, http.StatusOK)
+	assert.DeepEqual(t, do(h, "GET", "/readyz", "").Code, http.StatusServiceUnavailable)
+
+	a.AddFuncErr(time.Now(), func() error { return errors.New("boom") })
+	a.Start()
+	defer a.Stop()
+	assert.DeepEqual(t, do(h, "GET", "/readyz", "").Code, http.StatusOK)
+
+	var results []Result
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		rec := do(h, "GET", "/results", "")
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		if len(results) > 0 {
+			break
+		}
+	}
+	assert.Len(t, results, 1)
+	assert.DeepEqual(t, results[0].Status, "failed")
+	assert.DeepEqual(t, results[0].Error, "boom")
+}
+
+func jsonNumber(id at.EntryID) string {
+	b, _ := json.Marshal(id)
+	return string(b)
+}
+
+func TestSelector(t *testing.T) {
+	a := at.New()
+	h := NewHandler(a)
+	defer h.Close()
+
+	when := time.Now().Add(time.Hour)
+	a.AddFunc(when, func() {}, at.WithLabels(at.Labels{"tenant": "42"}))
+	a.AddFunc(when, func() {}, at.WithLabels(at.Labels{"tenant": "7"}))
+
+	var jobs []Job
+	rec := do(h, "GET", "/jobs?selector=tenant=42", "")
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &jobs))
+	assert.Len(t, jobs, 1)
+	assert.DeepEqual(t, jobs[0].Labels["tenant"], "42")
+
+	assert.DeepEqual(t, do(h, "DELETE", "/jobs", "").Code, http.StatusBadRequest)
+	rec = do(h, "DELETE", "/jobs?selector=tenant=42", "")
+	assert.DeepEqual(t, rec.Code, http.StatusOK)
+	assert.StringContains(t, rec.Body.String(), `"cancelled":[`)
+	assert.Len(t, a.Entries(), 1)
+}
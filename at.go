@@ -3,6 +3,8 @@ package at
 import (
 	"log"
 	"runtime"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/gotoxu/at/queue"
@@ -11,51 +13,263 @@ import (
 type At struct {
 	Log *log.Logger
 
-	entries  *queue.PriorityQueue
-	add      chan *entry
-	stop     chan struct{}
-	running  bool
-	location *time.Location
+	entries queue.TimerQueue[*entry]
+	index   map[EntryID]*entry
+	keys    map[string]EntryID
+	// Recurring entries, pending or running, by id.
+	recurring map[EntryID]*entry
+	// Entries that are running, by id.
+	active map[EntryID]*entry
+	// The ids of the entries waiting for each entry to settle.
+	dependents map[EntryID][]EntryID
+	// The number of running jobs by concurrency key, and the entries
+	// waiting for one of them to end.
+	slots       map[string]int
+	slotWaiters map[string][]*entry
+	// The rate limits jobs are dispatched under.
+	limits limiter
+
+	calendars map[string]*Calendar
+	nextID    EntryID
+	mu        sync.Mutex
+	wake      chan struct{}
+	stop      chan struct{}
+	running   bool
+	location  *time.Location
+
+	missedTolerance time.Duration
+	clockCheck      time.Duration
+	workers         chan struct{}
+
+	events  eventBus
+	metrics metrics
 }
 
+// EntryID identifies an entry within an At instance
+type EntryID int
+
 type entry struct {
+	// The ID of this entry, unique within the At instance.
+	ID EntryID
+
 	// The time the job will run.
 	At time.Time
 
+	// The time the job was planned for, before it was moved to a business
+	// day of its calendar.
+	planned time.Time
+
 	// The job to run
 	Job Job
+
+	// The schedule of a recurring entry, nil for a one-shot entry.
+	Schedule Schedule
+
+	// The wall clock time At was resolved from, if any, and how times that
+	// do not exist or occur twice in its time zone are resolved.
+	Wall    *WallTime
+	gap     GapPolicy
+	overlap OverlapPolicy
+
+	// The calendar whose business days the entry is constrained to, if any,
+	// and what happens on other days.
+	Calendar     string
+	businessDays BusinessDayPolicy
+
+	// The queue the entry belongs to.
+	Queue string
+
+	// Among entries due at the same time, those with a higher priority are
+	// dispatched first; entries with equal priority are dispatched in the
+	// order they were added.
+	Priority int
+
+	// The labels attached to the entry.
+	Labels Labels
+
+	// The unique key of the entry, if any, and how duplicates are resolved.
+	Key       string
+	keyPolicy KeyPolicy
+
+	// The concurrency key of the entry, if any, how many jobs with the key
+	// may run at once, and what happens when it is due while they do.
+	ConcurrencyKey string
+	maxConcurrency int
+	busy           BusyPolicy
+	busyDelay      time.Duration
+
+	// The token buckets the entry holds a token of, if the rate limits moved
+	// it to the time the tokens are earned, and the time it was due before.
+	reservation []*tokenBucket
+	due         time.Time
+
+	// The entries this entry waits for, with the outcome each must have.
+	// Settled dependencies are removed.
+	deps map[EntryID]Condition
+
+	// Why the entry was cancelled, if not on request.
+	cancelErr error
+
+	// The position of the entry in the queue, used to cancel and reschedule.
+	handle *queue.Handle
+}
+
+// Deadline returns the time the entry runs.
+func (e *entry) Deadline() time.Time {
+	return e.At
+}
+
+// dueTime returns the time the entry was due, before the rate limits held
+// it back.
+func (e *entry) dueTime() time.Time {
+	if e.due.IsZero() {
+		return e.At
+	}
+	return e.due
 }
 
-func (e entry) Compare(other queue.Item) int {
-	oe := other.(*entry)
-	if e.At.Before(oe.At) {
-		return -1
-	} else if e.At.After(oe.At) {
-		return 1
+// entryLess orders entries by time, then by descending priority. The queue
+// is stable, so entries that compare equal keep their submission order.
+func entryLess(a, b *entry) bool {
+	if !a.At.Equal(b.At) {
+		return a.At.Before(b.At)
 	}
 
-	return 0
+	return a.Priority > b.Priority
+}
+
+func (e *entry) snapshot() Entry {
+	return Entry{
+		ID:        e.ID,
+		At:        e.At,
+		Priority:  e.Priority,
+		Queue:     e.Queue,
+		Labels:    e.Labels.clone(),
+		Key:       e.Key,
+		Job:       e.Job,
+		Schedule:  e.Schedule,
+		Wall:      e.Wall.clone(),
+		Calendar:  e.Calendar,
+		DependsOn: e.dependsOn(),
+
+		ConcurrencyKey: e.ConcurrencyKey,
+	}
 }
 
 type Job interface {
 	Run()
 }
 
+// ErrJob is a Job that can report failure. When a job implements ErrJob,
+// At calls RunErr instead of Run and reports the returned error.
+type ErrJob interface {
+	Job
+	RunErr() error
+}
+
+// DefaultQueue is the queue entries belong to unless InQueue is given.
+const DefaultQueue = "default"
+
+// Entry is a snapshot of a pending entry.
+type Entry struct {
+	ID       EntryID
+	At       time.Time
+	Priority int
+	Queue    string
+	Labels   Labels
+	Key      string
+	Job      Job
+	Schedule Schedule
+	Wall     *WallTime
+	Calendar string
+	// The entries the entry still waits for.
+	DependsOn []EntryID
+
+	ConcurrencyKey string
+}
+
+// Option configures an At job runner.
+type Option func(*At)
+
+// WithMissedTolerance sets how late a job may be dispatched before it is
+// considered missed. Missed jobs are not run. A zero tolerance, the default,
+// runs every job no matter how late.
+func WithMissedTolerance(d time.Duration) Option {
+	return func(a *At) {
+		a.missedTolerance = d
+	}
+}
+
+// WithWorkers limits the number of jobs running at the same time to n.
+// Due jobs wait for a free worker. By default there is no limit.
+func WithWorkers(n int) Option {
+	return func(a *At) {
+		if n > 0 {
+			a.workers = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithTimingWheel keeps pending entries in a hierarchical timing wheel with
+// the given resolution instead of a binary heap. Adding and cancelling
+// entries is O(1), which pays off with millions of pending entries; jobs
+// still run at their exact time.
+func WithTimingWheel(tick time.Duration) Option {
+	return func(a *At) {
+		a.entries = queue.NewTimingWheelFunc(tick, time.Now(), entryLess, queue.Stable())
+	}
+}
+
+// JobOption configures a single entry when it is added.
+type JobOption func(*entry)
+
+// InQueue places the entry in the named queue. Queues group entries for
+// reporting; they share the same scheduler.
+func InQueue(name string) JobOption {
+	return func(e *entry) {
+		e.Queue = name
+	}
+}
+
+// WithPriority sets the priority of the entry. Among entries due at the same
+// time, those with a higher priority are dispatched first. The default
+// priority is 0.
+func WithPriority(p int) JobOption {
+	return func(e *entry) {
+		e.Priority = p
+	}
+}
+
 // New returns a new At job runner, in the local time zone.
-func New() *At {
-	return NewWithLocation(time.Now().Location())
+func New(opts ...Option) *At {
+	return NewWithLocation(time.Now().Location(), opts...)
 }
 
 // NewWithLocation returns a new At job runner.
-func NewWithLocation(locaton *time.Location) *At {
-	return &At{
-		entries:  queue.NewPriorityQueue(1),
-		add:      make(chan *entry),
-		stop:     make(chan struct{}),
-		running:  false,
-		Log:      nil,
-		location: locaton,
+func NewWithLocation(locaton *time.Location, opts ...Option) *At {
+	a := &At{
+		entries:     queue.NewDelayQueueFunc(1, entryLess, queue.Stable()),
+		index:       make(map[EntryID]*entry),
+		keys:        make(map[string]EntryID),
+		recurring:   make(map[EntryID]*entry),
+		active:      make(map[EntryID]*entry),
+		dependents:  make(map[EntryID][]EntryID),
+		slots:       make(map[string]int),
+		slotWaiters: make(map[string][]*entry),
+		calendars:   make(map[string]*Calendar),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		running:     false,
+		Log:         nil,
+		location:    locaton,
+
+		clockCheck: DefaultClockCheckInterval,
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
+
+	return a
 }
 
 // A wrapper that turns a func() into a at.Job
@@ -65,51 +279,315 @@ func (f FuncJob) Run() {
 	f()
 }
 
+// A wrapper that turns a func() error into a at.ErrJob
+type FuncErrJob func() error
+
+func (f FuncErrJob) Run() {
+	f()
+}
+
+func (f FuncErrJob) RunErr() error {
+	return f()
+}
+
 // AddFunc adds a func to the At to be run on the given schedule.
-func (a *At) AddFunc(t time.Time, cmd func()) {
-	a.AddJob(t, FuncJob(cmd))
+func (a *At) AddFunc(t time.Time, cmd func(), opts ...JobOption) (EntryID, error) {
+	return a.AddJob(t, FuncJob(cmd), opts...)
+}
+
+// AddFuncErr adds a func that may fail to the At to be run on the given
+// schedule.
+func (a *At) AddFuncErr(t time.Time, cmd func() error, opts ...JobOption) (EntryID, error) {
+	return a.AddJob(t, FuncErrJob(cmd), opts...)
 }
 
 // AddJob adds a Job to the At to be run on the given schedule.
-func (a *At) AddJob(t time.Time, cmd Job) {
+func (a *At) AddJob(t time.Time, cmd Job, opts ...JobOption) (EntryID, error) {
 	entry := &entry{
-		Job: cmd,
-		At:  t,
+		Job:   cmd,
+		At:    t,
+		Queue: DefaultQueue,
 	}
-	if !a.running {
-		a.entries.Push(entry)
-		return
+	for _, opt := range opts {
+		opt(entry)
 	}
 
-	a.add <- entry
+	return a.add(entry)
+}
+
+// add makes a new entry pending and returns its id.
+func (a *At) add(e *entry) (EntryID, error) {
+	a.mu.Lock()
+	dropped, kept, err := a.insert(e)
+	if kept != 0 || err != nil {
+		a.mu.Unlock()
+		return kept, err
+	}
+	// Once a.mu is released the dispatcher may move e.
+	added := Event{Type: Added, EntryID: e.ID, At: e.At}
+	a.mu.Unlock()
+
+	a.notify()
+	a.emitCancelled(dropped)
+	a.emit(added)
+	return added.EntryID, nil
+}
+
+// insert pushes e onto the queue, moving it to a business day of its
+// calendar and resolving its key, and assigns it an id unless it already has
+// one. It returns the entries cancelled in favour of e, or the id kept
+// instead of adding e. a.mu must be held.
+func (a *At) insert(e *entry) (dropped []*entry, kept EntryID, err error) {
+	if e.planned.IsZero() {
+		e.planned = wallClock(e.At)
+	}
+	if e.planned, e.At, err = a.applyCalendar(e); err != nil {
+		return nil, 0, err
+	}
+
+	if err := a.checkDeps(e); err != nil {
+		return nil, 0, err
+	}
+	replaced, kept, err := a.resolveKey(e)
+	if kept != 0 || err != nil {
+		return nil, kept, err
+	}
+
+	if e.ID == 0 {
+		a.nextID++
+		e.ID = a.nextID
+	}
+	handle, err := a.entries.PushHandle(e)
+	if err != nil {
+		return nil, 0, err
+	}
+	e.handle = handle
+	if replaced != nil {
+		dropped = a.drop(replaced)
+	}
+	a.index[e.ID] = e
+	if e.Key != "" {
+		a.keys[e.Key] = e.ID
+	}
+	if e.Schedule != nil {
+		a.recurring[e.ID] = e
+	}
+	for id := range e.deps {
+		a.dependents[id] = append(a.dependents[id], e.ID)
+	}
+	return dropped, 0, nil
+}
+
+// remove takes a pending entry out of the queue and forgets it. a.mu must be
+// held.
+func (a *At) remove(e *entry) {
+	if e.handle != nil {
+		a.entries.Remove(e.handle)
+	}
+	a.refund(e)
+	a.unindex(e)
+	delete(a.recurring, e.ID)
+}
+
+// drop removes a pending entry that will not run, and the entries that
+// depend on it running. It returns them all, e first. a.mu must be held.
+func (a *At) drop(e *entry) []*entry {
+	a.remove(e)
+	return append([]*entry{e}, a.settle(e.ID, outcomeNotRun)...)
+}
+
+// emitCancelled emits Cancelled for each of the entries.
+func (a *At) emitCancelled(es []*entry) {
+	for _, e := range es {
+		a.emit(e.cancelled())
+	}
+}
+
+// cancelled returns the Cancelled event of e.
+func (e *entry) cancelled() Event {
+	return Event{Type: Cancelled, EntryID: e.ID, At: e.At, Err: e.cancelErr}
+}
+
+// unindex forgets an entry that is no longer pending. a.mu must be held.
+func (a *At) unindex(e *entry) {
+	delete(a.index, e.ID)
+	if e.Key != "" && a.keys[e.Key] == e.ID {
+		delete(a.keys, e.Key)
+	}
+}
+
+// Cancel removes a pending entry so that its job never runs. It reports
+// whether the entry was still pending. A recurring entry can also be
+// cancelled while it runs, which stops its schedule.
+func (a *At) Cancel(id EntryID) bool {
+	a.mu.Lock()
+	e, ok := a.index[id]
+	if !ok {
+		e, ok = a.recurring[id]
+		if !ok {
+			a.mu.Unlock()
+			return false
+		}
+		delete(a.recurring, id)
+		a.mu.Unlock()
+
+		a.emit(Event{Type: Cancelled, EntryID: id, At: e.At})
+		return true
+	}
+	dropped := a.drop(e)
+	a.mu.Unlock()
+
+	a.notify()
+	a.emitCancelled(dropped)
+	return true
+}
+
+// Reschedule moves a pending entry to a new time. It reports whether the
+// entry was still pending and could be moved. A wall clock entry becomes a
+// plain entry at t, and an entry constrained to a calendar is moved to one of
+// its business days as when it was added.
+func (a *At) Reschedule(id EntryID, t time.Time) bool {
+	a.mu.Lock()
+	e, ok := a.index[id]
+	if !ok {
+		a.mu.Unlock()
+		return false
+	}
+	moved, err := a.move(e, t, nil)
+	if err != nil {
+		a.mu.Unlock()
+		return false
+	}
+	rescheduled := Event{Type: Rescheduled, EntryID: id, At: moved.At, Previous: e.At}
+	a.mu.Unlock()
+
+	a.notify()
+	a.emit(rescheduled)
+	return true
+}
+
+// move replaces a pending entry with a copy planned for t and resolved from
+// wall. a.mu must be held.
+func (a *At) move(e *entry, t time.Time, wall *WallTime) (*entry, error) {
+	moved := &entry{}
+	*moved = *e
+	moved.planned = wallClock(t)
+	moved.Wall = wall
+	if err := a.update(e, moved); err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// update replaces a pending entry with moved, a changed copy of it, due at
+// its planned time moved to a business day of its calendar. a.mu must be
+// held.
+func (a *At) update(e, moved *entry) error {
+	planned, t, err := a.applyCalendar(moved)
+	if err != nil {
+		return err
+	}
+	moved.planned, moved.At = planned, t
+	moved.reservation, moved.due = nil, time.Time{}
+	if e.handle == nil {
+		// The entry is waiting for its dependencies: it is due again at its
+		// new time.
+		handle, err := a.entries.PushHandle(moved)
+		if err != nil {
+			return err
+		}
+		moved.handle = handle
+	} else if err := a.entries.Update(e.handle, moved); err != nil {
+		return err
+	}
+	// The entry no longer runs at the time it reserved tokens for.
+	a.refund(e)
+	a.index[moved.ID] = moved
+	if moved.Schedule != nil {
+		a.recurring[moved.ID] = moved
+	}
+	return nil
+}
+
+// Entries returns a snapshot of the pending entries, ordered by time.
+func (a *At) Entries() []Entry {
+	a.mu.Lock()
+	entries := make([]Entry, 0, len(a.index))
+	for _, e := range a.index {
+		entries = append(entries, e.snapshot())
+	}
+	a.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].At.Equal(entries[j].At) {
+			return entries[i].At.Before(entries[j].At)
+		}
+		if entries[i].Priority != entries[j].Priority {
+			return entries[i].Priority > entries[j].Priority
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// Entry returns a snapshot of the pending entry with the given id.
+func (a *At) Entry(id EntryID) (Entry, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e, ok := a.index[id]
+	if !ok {
+		return Entry{}, false
+	}
+
+	return e.snapshot(), true
+}
+
+// Running reports whether the scheduler is running.
+func (a *At) Running() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.running
 }
 
 // Start the at scheduler in its own go-routine, or no-op if already started.
 func (a *At) Start() {
+	a.mu.Lock()
 	if a.running {
+		a.mu.Unlock()
 		return
 	}
 	a.running = true
+	a.mu.Unlock()
+
 	go a.run()
 }
 
 // Run the at scheduler, or no-op if already running.
 func (a *At) Run() {
+	a.mu.Lock()
 	if a.running {
+		a.mu.Unlock()
 		return
 	}
 	a.running = true
+	a.mu.Unlock()
+
 	a.run()
 }
 
 // Stop stops the at scheduler if it is running; otherwise it does nothing.
 func (a *At) Stop() {
+	a.mu.Lock()
 	if !a.running {
+		a.mu.Unlock()
 		return
 	}
+	a.running = false
+	a.mu.Unlock()
 
 	a.stop <- struct{}{}
-	a.running = false
 }
 
 // Location gets the time zone location
@@ -117,46 +595,97 @@ func (a *At) Location() *time.Location {
 	return a.location
 }
 
+// notify wakes the run loop so that it re-evaluates the head of the queue.
+func (a *At) notify() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
 func (a *At) run() {
-	now := a.now()
-	// for _, entry := range a.entries {
-	// 	entry.At = entry.Schedule.At(now)
-	// }
+	a.emit(Event{Type: SchedulerStarted})
 
+	last := time.Now()
 	for {
-		var timer *time.Timer
-		e := a.entries.Peek()
-		if e == nil {
-			// If there are no entries yet, just sleep - it still handles new entries
-			// and stop requests.
-			timer = time.NewTimer(100000 * time.Hour)
-		} else {
-			entry := e.(*entry)
-			timer = time.NewTimer(entry.At.Sub(now))
+		// Sleep no longer than the clock check interval, so that jobs still
+		// run by wall clock after a suspend or a clock correction.
+		wait := a.clockCheck
+		if next, ok := a.entries.NextDeadline(); ok {
+			wait = min(wait, next.Sub(a.now()))
+		}
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-timer.C:
+			now := time.Now()
+			a.checkClock(last, now)
+			last = now
+			a.runDue(wallClock(now).In(a.location))
+
+		case <-a.wake:
+			timer.Stop()
+
+		case <-a.stop:
+			timer.Stop()
+			a.entries.Dispose()
+			a.emit(Event{Type: SchedulerStopped})
+			return
 		}
+	}
+}
 
-		for {
-			select {
-			case now = <-timer.C:
-				now = now.In(a.location)
-
-				e, err := a.entries.Pop()
-				if err == nil && e != nil {
-					entry := e.(*entry)
-					go a.runWithRecovery(entry.Job)
-				}
-
-			case newEntry := <-a.add:
-				timer.Stop()
-				a.entries.Push(newEntry)
-
-			case <-a.stop:
-				timer.Stop()
-				a.entries.Dispose()
-				return
+// runDue pops every entry that is due at now and dispatches its job.
+func (a *At) runDue(now time.Time) {
+	for {
+		a.mu.Lock()
+		entry, ok := a.entries.PopExpired(now)
+		if !ok {
+			a.mu.Unlock()
+			return
+		}
+		if len(entry.deps) > 0 {
+			// The entry stays pending, out of the queue, until its
+			// dependencies settle.
+			entry.handle = nil
+			a.mu.Unlock()
+			continue
+		}
+		if !a.acquire(entry) {
+			events, requeue := a.busy(entry, now)
+			a.mu.Unlock()
+
+			for _, ev := range events {
+				a.emit(ev)
+			}
+			if requeue {
+				a.requeue(entry)
 			}
+			continue
+		}
+		if a.missedTolerance > 0 && now.Sub(entry.dueTime()) > a.missedTolerance {
+			// A missed entry spends no tokens.
+			a.refund(entry)
+			a.unindex(entry)
+			a.active[entry.ID] = entry
+			a.mu.Unlock()
+
+			a.metrics.missed(entry.Queue)
+			a.emit(Event{Type: Missed, EntryID: entry.ID, At: entry.At})
+			a.finish(entry, outcomeNotRun)
+			if entry.Schedule != nil {
+				a.requeue(entry)
+			}
+			continue
+		}
+		events, run := a.start(entry, now)
+		a.mu.Unlock()
 
-			break
+		for _, ev := range events {
+			a.emit(ev)
+		}
+		if run != nil {
+			go a.runWithRecovery(run)
 		}
 	}
 }
@@ -170,17 +699,48 @@ func (a *At) logf(format string, args ...interface{}) {
 	}
 }
 
-func (a *At) runWithRecovery(j Job) {
+func (a *At) runWithRecovery(e *entry) {
+	if e.Schedule != nil {
+		defer a.requeue(e)
+	}
+	o := outcomePanicked
+	defer func() { a.finish(e, o) }()
+	if a.workers != nil {
+		a.workers <- struct{}{}
+		defer func() { <-a.workers }()
+	}
+
+	start := a.now()
+	a.metrics.started(e.Queue, start.Sub(e.dueTime()))
+	a.emit(Event{Type: Started, EntryID: e.ID, At: e.At, Time: start})
+
 	defer func() {
 		if r := recover(); r != nil {
 			const size = 64 << 10
 			buf := make([]byte, size)
 			buf = buf[:runtime.Stack(buf, false)]
 			a.logf("at: panic running job: %v\n%s", r, buf)
+			a.metrics.finished(e.Queue, a.now().Sub(start), outcomePanicked)
+			a.emit(Event{Type: Panicked, EntryID: e.ID, At: e.At, Duration: a.now().Sub(start), Panic: r})
 		}
 	}()
 
-	j.Run()
+	var err error
+	if ej, ok := e.Job.(ErrJob); ok {
+		err = ej.RunErr()
+	} else {
+		e.Job.Run()
+	}
+
+	if err != nil {
+		o = outcomeFailed
+		a.metrics.finished(e.Queue, a.now().Sub(start), outcomeFailed)
+		a.emit(Event{Type: Failed, EntryID: e.ID, At: e.At, Duration: a.now().Sub(start), Err: err})
+		return
+	}
+	o = outcomeSucceeded
+	a.metrics.finished(e.Queue, a.now().Sub(start), outcomeSucceeded)
+	a.emit(Event{Type: Succeeded, EntryID: e.ID, At: e.At, Duration: a.now().Sub(start)})
 }
 
 // now returns current time in location
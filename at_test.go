@@ -39,3 +39,101 @@ func TestRun(t *testing.T) {
 	time.Sleep(6 * time.Second)
 	assert.DeepEqual(t, at.entries.Len(), 0)
 }
+
+func TestCancel(t *testing.T) {
+	at := New()
+	ran := make(chan struct{}, 1)
+	id, err := at.AddFunc(time.Now().Add(50*time.Millisecond), func() {
+		ran <- struct{}{}
+	})
+	assert.Nil(t, err)
+
+	at.Start()
+	defer at.Stop()
+	assert.True(t, at.Cancel(id))
+
+	select {
+	case <-ran:
+		t.Fatal("cancelled job should not run")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestReschedule(t *testing.T) {
+	at := New()
+	ran := make(chan time.Time, 1)
+	id, _ := at.AddFunc(time.Now().Add(time.Hour), func() {
+		ran <- time.Now()
+	})
+
+	at.Start()
+	defer at.Stop()
+	assert.True(t, at.Reschedule(id, time.Now().Add(20*time.Millisecond)))
+
+	select {
+	case <-ran:
+	case <-time.After(2 * time.Second):
+		t.Fatal("rescheduled job did not run")
+	}
+}
+
+func TestEntries(t *testing.T) {
+	at := New()
+	now := time.Now()
+	second, _ := at.AddFunc(now.Add(2*time.Hour), func() {})
+	first, _ := at.AddFunc(now.Add(time.Hour), func() {}, InQueue("mail"))
+
+	entries := at.Entries()
+	assert.Len(t, entries, 2)
+	assert.DeepEqual(t, entries[0].ID, first)
+	assert.DeepEqual(t, entries[0].Queue, "mail")
+	assert.DeepEqual(t, entries[1].ID, second)
+
+	at.Cancel(first)
+	_, ok := at.Entry(first)
+	assert.False(t, ok)
+	e, ok := at.Entry(second)
+	assert.True(t, ok)
+	assert.DeepEqual(t, e.Queue, DefaultQueue)
+}
+
+func TestTimingWheel(t *testing.T) {
+	at := New(WithTimingWheel(time.Millisecond))
+	ran := make(chan EntryID, 2)
+	first, _ := at.AddFunc(time.Now().Add(20*time.Millisecond), func() { ran <- 1 })
+	cancelled, _ := at.AddFunc(time.Now().Add(10*time.Millisecond), func() { ran <- 2 })
+	assert.True(t, at.Cancel(cancelled))
+
+	at.Start()
+	defer at.Stop()
+
+	select {
+	case id := <-ran:
+		assert.DeepEqual(t, id, first)
+	case <-time.After(2 * time.Second):
+		t.Fatal("job did not run")
+	}
+	assert.DeepEqual(t, at.entries.Len(), 0)
+}
+
+func TestDispatchOrder(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithTimingWheel(time.Millisecond)}} {
+		at := New(opts...)
+		when := time.Now().Add(time.Hour)
+		a, _ := at.AddFunc(when, func() {})
+		b, _ := at.AddFunc(when, func() {})
+		c, _ := at.AddFunc(when, func() {}, WithPriority(1))
+		d, _ := at.AddFunc(when, func() {})
+		early, _ := at.AddFunc(when.Add(-time.Minute), func() {}, WithPriority(-1))
+
+		var order []EntryID
+		for {
+			e, ok := at.entries.PopExpired(when)
+			if !ok {
+				break
+			}
+			order = append(order, e.ID)
+		}
+		assert.DeepEqual(t, order, []EntryID{early, c, a, b, d})
+	}
+}
@@ -0,0 +1,576 @@
+package at
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownCalendar is returned when an entry names a calendar that was
+	// not added with AddCalendar.
+	ErrUnknownCalendar = errors.New("at: unknown calendar")
+
+	// ErrNotBusinessDay is returned when a one-shot entry under the
+	// SkipNonBusinessDay policy falls on a day that is not a business day.
+	ErrNotBusinessDay = errors.New("at: not a business day")
+)
+
+// civilDate is a day on the calendar, independent of time zones.
+type civilDate struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+func dateOf(t time.Time) civilDate {
+	y, m, d := t.Date()
+	return civilDate{y, m, d}
+}
+
+// annualHoliday is a holiday on the same day every year from one year to
+// another, inclusive, except in the years listed. A zero bound is open.
+type annualHoliday struct {
+	name        string
+	from, until int
+	except      []int
+}
+
+// covers reports whether the holiday falls in year.
+func (h annualHoliday) covers(year int) bool {
+	if (h.from != 0 && year < h.from) || (h.until != 0 && year > h.until) {
+		return false
+	}
+	for _, y := range h.except {
+		if y == year {
+			return false
+		}
+	}
+	return true
+}
+
+// Calendar is a named set of business days: every day that is neither a
+// weekend day nor a holiday. It is safe for concurrent use.
+type Calendar struct {
+	name     string
+	location *time.Location
+
+	mu       sync.RWMutex
+	weekend  [7]bool
+	holidays map[civilDate]string
+	annual   map[civilDate][]annualHoliday // year is always 0
+}
+
+// NewCalendar returns a calendar with Saturday and Sunday as weekend days and
+// no holidays. Days are evaluated in loc, or in the At's time zone if loc is
+// nil.
+func NewCalendar(name string, loc *time.Location) *Calendar {
+	c := &Calendar{
+		name:     name,
+		location: loc,
+		holidays: make(map[civilDate]string),
+		annual:   make(map[civilDate][]annualHoliday),
+	}
+	c.weekend[time.Saturday] = true
+	c.weekend[time.Sunday] = true
+	return c
+}
+
+// Name returns the name of the calendar.
+func (c *Calendar) Name() string {
+	return c.name
+}
+
+// SetWeekend replaces the weekend days.
+func (c *Calendar) SetWeekend(days ...time.Weekday) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.weekend = [7]bool{}
+	for _, d := range days {
+		c.weekend[d] = true
+	}
+}
+
+// AddHoliday marks the day of date as a holiday.
+func (c *Calendar) AddHoliday(date time.Time, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.holidays[dateOf(date)] = name
+}
+
+// AddAnnualHoliday marks the given day as a holiday every year.
+func (c *Calendar) AddAnnualHoliday(month time.Month, day int, name string) {
+	c.addAnnual(month, day, annualHoliday{name: name})
+}
+
+func (c *Calendar) addAnnual(month time.Month, day int, h annualHoliday) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := civilDate{0, month, day}
+	c.annual[key] = append(c.annual[key], h)
+}
+
+// Holiday returns the name of the holiday on the day of t, if any.
+func (c *Calendar) Holiday(t time.Time) (string, bool) {
+	if c.location != nil {
+		t = t.In(c.location)
+	}
+	date := dateOf(t)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if name, ok := c.holidays[date]; ok {
+		return name, true
+	}
+	for _, h := range c.annual[civilDate{0, date.month, date.day}] {
+		if h.covers(date.year) {
+			return h.name, true
+		}
+	}
+	return "", false
+}
+
+// IsBusinessDay reports whether the day of t is neither a weekend day nor a
+// holiday.
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	if c.location != nil {
+		t = t.In(c.location)
+	}
+
+	c.mu.RLock()
+	weekend := c.weekend[t.Weekday()]
+	c.mu.RUnlock()
+	if weekend {
+		return false
+	}
+
+	_, holiday := c.Holiday(t)
+	return !holiday
+}
+
+// maxCalendarDays bounds the search for a business day, so that a calendar
+// without any ends.
+const maxCalendarDays = 3 * 366
+
+// NextBusinessDay returns the same time of day on the first business day
+// after the day of t. It returns the zero time if there is none.
+func (c *Calendar) NextBusinessDay(t time.Time) time.Time {
+	return c.shift(t, 1)
+}
+
+// PreviousBusinessDay returns the same time of day on the last business day
+// before the day of t. It returns the zero time if there is none.
+func (c *Calendar) PreviousBusinessDay(t time.Time) time.Time {
+	return c.shift(t, -1)
+}
+
+func (c *Calendar) shift(t time.Time, dir int) time.Time {
+	if c.location != nil {
+		t = t.In(c.location)
+	}
+
+	y, m, d := t.Date()
+	h, mi, s := t.Clock()
+	for i := 1; i <= maxCalendarDays; i++ {
+		next := time.Date(y, m, d+dir*i, h, mi, s, t.Nanosecond(), t.Location())
+		if c.IsBusinessDay(next) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseHolidays reads a calendar from a simple holiday file. Each line holds
+// one of
+//
+//	2024-12-25 Christmas Day   a holiday on one date
+//	*-12-25 Christmas Day      a holiday on the same day every year
+//	weekend fri sat            the weekend days, Saturday and Sunday by default
+//
+// Blank lines and lines starting with # are ignored.
+func ParseHolidays(name string, loc *time.Location, r io.Reader) (*Calendar, error) {
+	c := NewCalendar(name, loc)
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		field, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		switch {
+		case field == "weekend":
+			var days []time.Weekday
+			for _, s := range strings.FieldsFunc(rest, func(r rune) bool { return r == ',' || r == ' ' }) {
+				d, ok := weekdayNames[strings.ToLower(s)]
+				if !ok {
+					return nil, fmt.Errorf("at: holiday file line %d: unknown weekday %q", n, s)
+				}
+				days = append(days, d)
+			}
+			c.SetWeekend(days...)
+
+		case strings.HasPrefix(field, "*-"):
+			date, err := time.Parse("01-02", field[2:])
+			if err != nil {
+				return nil, fmt.Errorf("at: holiday file line %d: %v", n, err)
+			}
+			c.AddAnnualHoliday(date.Month(), date.Day(), rest)
+
+		default:
+			date, err := time.Parse("2006-01-02", field)
+			if err != nil {
+				return nil, fmt.Errorf("at: holiday file line %d: %v", n, err)
+			}
+			c.AddHoliday(date, rest)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ParseICalendar reads a calendar from an iCalendar (RFC 5545) stream, such
+// as the holiday calendars published by banks and governments. Every VEVENT
+// is a holiday from its DTSTART date up to its DTEND date, exclusive, or on
+// its DTSTART date alone without DTEND; its SUMMARY names the holiday. An
+// event that recurs with RRULE:FREQ=YEARLY is a holiday every year, up to its
+// UNTIL or COUNT; other recurrence rules are not supported. RDATE adds
+// occurrences of the same length and EXDATE removes them. Components nested
+// in a VEVENT, such as VALARM, are ignored.
+func ParseICalendar(name string, loc *time.Location, r io.Reader) (*Calendar, error) {
+	c := NewCalendar(name, loc)
+
+	var (
+		lines []string
+		// The components open at the current line, innermost last.
+		open  []string
+		event map[string]string
+	)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		// Long lines are folded by starting their continuation with a space
+		// or a tab.
+		if n := len(lines); n > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[n-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		prop, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		prop, _, _ = strings.Cut(prop, ";")
+		prop = strings.ToUpper(prop)
+
+		switch {
+		case prop == "BEGIN":
+			component := strings.ToUpper(value)
+			open = append(open, component)
+			if component == "VEVENT" {
+				event = make(map[string]string)
+			}
+		case prop == "END":
+			component := strings.ToUpper(value)
+			n := len(open)
+			if n == 0 || open[n-1] != component {
+				return nil, fmt.Errorf("at: iCalendar END:%s without BEGIN", component)
+			}
+			open = open[:n-1]
+			if component != "VEVENT" {
+				continue
+			}
+			if err := c.addEvent(event); err != nil {
+				return nil, err
+			}
+		case len(open) > 0 && open[len(open)-1] == "VEVENT":
+			// Date lists may be given over several lines.
+			if prev, ok := event[prop]; ok && (prop == "EXDATE" || prop == "RDATE") {
+				value = prev + "," + value
+			}
+			event[prop] = value
+		}
+	}
+	if n := len(open); n > 0 {
+		return nil, fmt.Errorf("at: iCalendar %s is not terminated", open[n-1])
+	}
+
+	return c, nil
+}
+
+// addEvent adds the holidays of a VEVENT, given by its properties.
+func (c *Calendar) addEvent(event map[string]string) error {
+	start, err := parseICalendarDate(event["DTSTART"])
+	if err != nil {
+		return err
+	}
+	end := start.AddDate(0, 0, 1)
+	if v, ok := event["DTEND"]; ok {
+		if end, err = parseICalendarDate(v); err != nil {
+			return err
+		}
+		if !end.After(start) {
+			end = start.AddDate(0, 0, 1)
+		}
+	}
+	summary := strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\\`, `\`).Replace(event["SUMMARY"])
+	length := int(end.Sub(start) / (24 * time.Hour))
+
+	excluded, err := parseICalendarDates(event["EXDATE"])
+	if err != nil {
+		return err
+	}
+	added, err := parseICalendarDates(event["RDATE"])
+	if err != nil {
+		return err
+	}
+
+	rule, yearly := event["RRULE"], false
+	var from, until int
+	if rule != "" {
+		yearly = true
+		from = start.Year()
+		for _, part := range strings.Split(rule, ";") {
+			key, value, _ := strings.Cut(part, "=")
+			switch strings.ToUpper(key) {
+			case "FREQ":
+				if !strings.EqualFold(value, "YEARLY") {
+					return fmt.Errorf("at: unsupported iCalendar RRULE %q", rule)
+				}
+			case "INTERVAL":
+				if value != "1" {
+					return fmt.Errorf("at: unsupported iCalendar RRULE %q", rule)
+				}
+			case "UNTIL":
+				u, err := parseICalendarDate(value)
+				if err != nil {
+					return err
+				}
+				until = u.Year()
+			case "COUNT":
+				var n int
+				if _, err := fmt.Sscanf(value, "%d", &n); err != nil || n < 1 {
+					return fmt.Errorf("at: invalid iCalendar RRULE %q", rule)
+				}
+				until = from + n - 1
+			default:
+				return fmt.Errorf("at: unsupported iCalendar RRULE %q", rule)
+			}
+		}
+	}
+
+	// addDays adds the days of the occurrence starting at d, unless it is
+	// excluded.
+	addDays := func(d time.Time) {
+		for _, x := range excluded {
+			if x.Equal(d) {
+				return
+			}
+		}
+		for i := 0; i < length; i++ {
+			c.AddHoliday(d.AddDate(0, 0, i), summary)
+		}
+	}
+	for _, d := range added {
+		addDays(d)
+	}
+	if !yearly {
+		addDays(start)
+		return nil
+	}
+	for i := 0; i < length; i++ {
+		d := start.AddDate(0, 0, i)
+		h := annualHoliday{name: summary, from: from, until: until}
+		for _, x := range excluded {
+			if x.Month() == start.Month() && x.Day() == start.Day() {
+				h.except = append(h.except, x.AddDate(0, 0, i).Year())
+			}
+		}
+		c.addAnnual(d.Month(), d.Day(), h)
+	}
+	return nil
+}
+
+// parseICalendarDate returns the date of an iCalendar DATE or DATE-TIME
+// value, such as 20241225 or 20241225T090000Z.
+func parseICalendarDate(v string) (time.Time, error) {
+	if len(v) < 8 {
+		return time.Time{}, fmt.Errorf("at: invalid iCalendar date %q", v)
+	}
+	d, err := time.Parse("20060102", v[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("at: invalid iCalendar date %q", v)
+	}
+	return d, nil
+}
+
+// parseICalendarDates returns the dates of a comma separated list of
+// iCalendar DATE or DATE-TIME values. Periods are not supported.
+func parseICalendarDates(v string) ([]time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	var dates []time.Time
+	for _, s := range strings.Split(v, ",") {
+		if strings.Contains(s, "/") {
+			return nil, fmt.Errorf("at: unsupported iCalendar period %q", s)
+		}
+		d, err := parseICalendarDate(s)
+		if err != nil {
+			return nil, err
+		}
+		dates = append(dates, d)
+	}
+	return dates, nil
+}
+
+// BusinessDayPolicy decides what happens to an entry that falls on a day
+// that is not a business day of its calendar.
+type BusinessDayPolicy int
+
+const (
+	// NextBusinessDay moves the entry to the same time of day on the next
+	// business day.
+	NextBusinessDay BusinessDayPolicy = iota
+	// PreviousBusinessDay moves the entry to the same time of day on the
+	// previous business day. If that time has passed, the entry runs at once.
+	PreviousBusinessDay
+	// SkipNonBusinessDay does not run the entry. A one-shot entry is refused
+	// with ErrNotBusinessDay; a recurring entry moves on to the next time of
+	// its schedule that falls on a business day.
+	SkipNonBusinessDay
+)
+
+// OnBusinessDays constrains the entry to the business days of the named
+// calendar, which must have been added with AddCalendar.
+func OnBusinessDays(calendar string, policy BusinessDayPolicy) JobOption {
+	return func(e *entry) {
+		e.Calendar = calendar
+		e.businessDays = policy
+	}
+}
+
+// AddCalendar makes a calendar available to entries under its name. Adding a
+// calendar with the name of an existing one replaces it, and the pending
+// entries constrained to it are placed again from their planned times; those
+// that no longer have a business day to run on are cancelled.
+func (a *At) AddCalendar(c *Calendar) {
+	type move struct {
+		id       EntryID
+		at, prev time.Time
+	}
+
+	a.mu.Lock()
+	a.calendars[c.Name()] = c
+
+	var (
+		moves     []move
+		cancelled []*entry
+	)
+	for _, e := range a.index {
+		if e.Calendar != c.Name() {
+			continue
+		}
+
+		moved := &entry{}
+		*moved = *e
+		if err := a.update(e, moved); err != nil {
+			e.cancelErr = err
+			cancelled = append(cancelled, a.drop(e)...)
+			continue
+		}
+		if !moved.At.Equal(e.At) {
+			moves = append(moves, move{id: e.ID, at: moved.At, prev: e.At})
+		}
+	}
+	a.mu.Unlock()
+
+	if len(moves) > 0 || len(cancelled) > 0 {
+		a.notify()
+	}
+	a.emitCancelled(cancelled)
+	for _, m := range moves {
+		a.emit(Event{Type: Rescheduled, EntryID: m.id, At: m.at, Previous: m.prev})
+	}
+}
+
+// Calendar returns the calendar added under name.
+func (a *At) Calendar(name string) (*Calendar, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c, ok := a.calendars[name]
+	return c, ok
+}
+
+// applyCalendar returns the planned time of e and the time it runs, adjusted
+// to the business days of its calendar. a.mu must be held.
+func (a *At) applyCalendar(e *entry) (planned, at time.Time, err error) {
+	planned = e.planned
+	if e.Calendar == "" {
+		return planned, planned, nil
+	}
+
+	c, ok := a.calendars[e.Calendar]
+	if !ok {
+		return planned, planned, fmt.Errorf("%w %q", ErrUnknownCalendar, e.Calendar)
+	}
+	loc := a.location
+	if c.location != nil {
+		loc = c.location
+	}
+
+	for i := 0; i < maxCalendarDays; i++ {
+		if c.IsBusinessDay(planned.In(loc)) {
+			return planned, planned, nil
+		}
+
+		switch e.businessDays {
+		case NextBusinessDay, PreviousBusinessDay:
+			dir := 1
+			if e.businessDays == PreviousBusinessDay {
+				dir = -1
+			}
+			at = c.shift(planned.In(loc), dir)
+			if at.IsZero() {
+				return planned, planned, ErrNotBusinessDay
+			}
+			return planned, at, nil
+
+		default:
+			if e.Schedule == nil {
+				return planned, planned, ErrNotBusinessDay
+			}
+			if planned = e.Schedule.Next(planned); planned.IsZero() {
+				return planned, planned, ErrNoNextRun
+			}
+		}
+	}
+
+	return planned, planned, ErrNotBusinessDay
+}
@@ -0,0 +1,178 @@
+package at
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+const holidayFile = `
+# Bank holidays
+2031-12-25 Christmas Day
+2031-12-26 Boxing Day
+*-01-01 New Year's Day
+`
+
+func TestParseHolidays(t *testing.T) {
+	c, err := ParseHolidays("bank", time.UTC, strings.NewReader(holidayFile))
+	assert.Nil(t, err)
+	assert.DeepEqual(t, c.Name(), "bank")
+
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 10, 0, 0, 0, time.UTC)
+	}
+	name, ok := c.Holiday(day(2031, time.December, 25))
+	assert.True(t, ok)
+	assert.DeepEqual(t, name, "Christmas Day")
+	_, ok = c.Holiday(day(2032, time.December, 25))
+	assert.False(t, ok)
+	name, _ = c.Holiday(day(2040, time.January, 1))
+	assert.DeepEqual(t, name, "New Year's Day")
+
+	// 24 December 2031 is a Wednesday, 27 and 28 December the weekend.
+	assert.True(t, c.IsBusinessDay(day(2031, time.December, 24)))
+	assert.False(t, c.IsBusinessDay(day(2031, time.December, 27)))
+	assert.DeepEqual(t, c.NextBusinessDay(day(2031, time.December, 24)), day(2031, time.December, 29))
+	assert.DeepEqual(t, c.PreviousBusinessDay(day(2031, time.December, 29)), day(2031, time.December, 24))
+
+	c, err = ParseHolidays("gulf", time.UTC, strings.NewReader("weekend fri,sat\n"))
+	assert.Nil(t, err)
+	assert.False(t, c.IsBusinessDay(day(2031, time.December, 26)))
+	assert.True(t, c.IsBusinessDay(day(2031, time.December, 28)))
+
+	for _, bad := range []string{"2031-13-01", "*-02-30 x", "weekend someday"} {
+		_, err = ParseHolidays("bad", nil, strings.NewReader(bad))
+		assert.NotNil(t, err)
+	}
+}
+
+const icsFile = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20310414\r\n" +
+	"DTEND;VALUE=DATE:20310416\r\n" +
+	"SUMMARY:Easter\r\n" +
+	"  break\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20300501\r\n" +
+	"RRULE:FREQ=YEARLY;COUNT=3\r\n" +
+	"SUMMARY:Labour Day\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20301111\r\n" +
+	"RRULE:FREQ=YEARLY\r\n" +
+	"EXDATE;VALUE=DATE:20311111\r\n" +
+	"EXDATE;VALUE=DATE:20321111,20331111\r\n" +
+	"RDATE;VALUE=DATE:20331110\r\n" +
+	"SUMMARY:Armistice Day\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:EMAIL\r\n" +
+	"SUMMARY:Reminder\r\n" +
+	"TRIGGER:-P1D\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20310601\r\n" +
+	"EXDATE;VALUE=DATE:20310601\r\n" +
+	"RDATE;VALUE=DATE:20310602\r\n" +
+	"SUMMARY:Moved\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseICalendar(t *testing.T) {
+	c, err := ParseICalendar("bank", time.UTC, strings.NewReader(icsFile))
+	assert.Nil(t, err)
+
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	name, ok := c.Holiday(day(2031, time.April, 15))
+	assert.True(t, ok)
+	assert.DeepEqual(t, name, "Easter break")
+	_, ok = c.Holiday(day(2031, time.April, 16))
+	assert.False(t, ok)
+
+	_, ok = c.Holiday(day(2029, time.May, 1))
+	assert.False(t, ok)
+	_, ok = c.Holiday(day(2032, time.May, 1))
+	assert.True(t, ok)
+	_, ok = c.Holiday(day(2033, time.May, 1))
+	assert.False(t, ok)
+
+	// EXDATE removes occurrences and RDATE adds them; the alarm does not
+	// rename the event.
+	name, ok = c.Holiday(day(2030, time.November, 11))
+	assert.True(t, ok)
+	assert.DeepEqual(t, name, "Armistice Day")
+	for y := 2031; y <= 2033; y++ {
+		_, ok = c.Holiday(day(y, time.November, 11))
+		assert.False(t, ok)
+	}
+	_, ok = c.Holiday(day(2034, time.November, 11))
+	assert.True(t, ok)
+	_, ok = c.Holiday(day(2033, time.November, 10))
+	assert.True(t, ok)
+	_, ok = c.Holiday(day(2031, time.June, 1))
+	assert.False(t, ok)
+	name, _ = c.Holiday(day(2031, time.June, 2))
+	assert.DeepEqual(t, name, "Moved")
+
+	for _, bad := range []string{
+		"BEGIN:VEVENT\nDTSTART:2031\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:20310101\nRRULE:FREQ=WEEKLY\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:20310101\n",
+		"BEGIN:VEVENT\nDTSTART:20310101\nRDATE;VALUE=PERIOD:20310102T000000Z/P1D\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:20310101\nBEGIN:VALARM\nEND:VEVENT\n",
+	} {
+		_, err = ParseICalendar("bad", nil, strings.NewReader(bad))
+		assert.NotNil(t, err)
+	}
+}
+
+func TestBusinessDays(t *testing.T) {
+	at := NewWithLocation(time.UTC)
+	c, _ := ParseHolidays("bank", nil, strings.NewReader(holidayFile))
+	at.AddCalendar(c)
+
+	// Thursday 25 December 2031 is Christmas Day.
+	christmas := time.Date(2031, 12, 25, 9, 0, 0, 0, time.UTC)
+	next, err := at.AddFunc(christmas, func() {}, OnBusinessDays("bank", NextBusinessDay))
+	assert.Nil(t, err)
+	e, _ := at.Entry(next)
+	assert.DeepEqual(t, e.At, time.Date(2031, 12, 29, 9, 0, 0, 0, time.UTC))
+	assert.DeepEqual(t, e.Calendar, "bank")
+
+	prev, err := at.AddFunc(christmas, func() {}, OnBusinessDays("bank", PreviousBusinessDay))
+	assert.Nil(t, err)
+	e, _ = at.Entry(prev)
+	assert.DeepEqual(t, e.At, time.Date(2031, 12, 24, 9, 0, 0, 0, time.UTC))
+
+	_, err = at.AddFunc(christmas, func() {}, OnBusinessDays("bank", SkipNonBusinessDay))
+	assert.True(t, err == ErrNotBusinessDay)
+	_, err = at.AddFunc(christmas, func() {}, OnBusinessDays("nope", NextBusinessDay))
+	assert.NotNil(t, err)
+
+	// A recurring entry skips the days that are not business days.
+	daily, err := at.ScheduleFunc(Times(christmas, christmas.AddDate(0, 0, 1), christmas.AddDate(0, 0, 5)),
+		func() {}, OnBusinessDays("bank", SkipNonBusinessDay))
+	assert.Nil(t, err)
+	e, _ = at.Entry(daily)
+	assert.DeepEqual(t, e.At, christmas.AddDate(0, 0, 5))
+
+	// Replacing the calendar places the entries again from their planned time.
+	sub := at.Subscribe(4)
+	defer sub.Close()
+	at.AddCalendar(NewCalendar("bank", nil))
+	e, _ = at.Entry(next)
+	assert.DeepEqual(t, e.At, christmas)
+	ev := nextEvent(t, sub)
+	assert.DeepEqual(t, ev.Type, Rescheduled)
+
+	// Rescheduling honours the calendar too.
+	assert.True(t, at.Reschedule(next, time.Date(2031, 12, 27, 9, 0, 0, 0, time.UTC)))
+	e, _ = at.Entry(next)
+	assert.DeepEqual(t, e.At, time.Date(2031, 12, 29, 9, 0, 0, 0, time.UTC))
+}
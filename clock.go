@@ -0,0 +1,51 @@
+package at
+
+import "time"
+
+const (
+	// DefaultClockCheckInterval is how often the scheduler re-evaluates the
+	// queue against the wall clock unless WithClockCheckInterval is given.
+	DefaultClockCheckInterval = time.Second
+
+	// clockJumpThreshold is how far the wall clock may drift from the
+	// monotonic clock between two checks before it counts as a jump.
+	clockJumpThreshold = time.Second
+)
+
+// WithClockCheckInterval sets how long the scheduler sleeps at most before it
+// re-evaluates the queue. Jobs run by wall clock time, but timers run on the
+// monotonic clock, which stops while the host is suspended and ignores
+// corrections of the wall clock; after either, jobs run at most d late. A
+// non-positive d restores the default.
+func WithClockCheckInterval(d time.Duration) Option {
+	return func(a *At) {
+		if d <= 0 {
+			d = DefaultClockCheckInterval
+		}
+		a.clockCheck = d
+	}
+}
+
+// wallClock returns t without its monotonic clock reading, so that it is
+// compared with other times by wall clock.
+func wallClock(t time.Time) time.Time {
+	return t.Round(0)
+}
+
+// clockJump returns how far the wall clock moved between then and now beyond
+// the time that actually elapsed. It is positive when the clock jumped
+// forward or the host was suspended, and negative when the clock was set
+// back.
+func clockJump(then, now time.Time) time.Duration {
+	return wallClock(now).Sub(wallClock(then)) - now.Sub(then)
+}
+
+// checkClock emits ClockJumped if the wall clock jumped between then and now.
+func (a *At) checkClock(then, now time.Time) {
+	jump := clockJump(then, now)
+	if jump < clockJumpThreshold && jump > -clockJumpThreshold {
+		return
+	}
+
+	a.emit(Event{Type: ClockJumped, Time: now, Duration: jump})
+}
@@ -0,0 +1,45 @@
+package at
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+func TestClockJump(t *testing.T) {
+	then := time.Now()
+	assert.DeepEqual(t, clockJump(then, then.Add(time.Minute)), time.Duration(0))
+	assert.DeepEqual(t, ClockJumped.String(), "clock_jumped")
+}
+
+func TestEntriesUseWallClock(t *testing.T) {
+	at := New()
+	id, err := at.AddFunc(time.Now().Add(time.Hour), func() {})
+	assert.Nil(t, err)
+
+	// The monotonic clock reading is dropped: it stops while the host is
+	// suspended.
+	e, _ := at.Entry(id)
+	assert.DeepEqual(t, e.At, e.At.Round(0))
+}
+
+func TestClockCheckInterval(t *testing.T) {
+	at := New(WithClockCheckInterval(-time.Second))
+	assert.DeepEqual(t, at.clockCheck, DefaultClockCheckInterval)
+
+	// With a short interval the scheduler keeps waking up and still runs
+	// jobs on time.
+	at = New(WithClockCheckInterval(10 * time.Millisecond))
+	ran := make(chan struct{})
+	_, err := at.AddFunc(time.Now().Add(50*time.Millisecond), func() { close(ran) })
+	assert.Nil(t, err)
+
+	at.Start()
+	defer at.Stop()
+	select {
+	case <-ran:
+	case <-time.After(2 * time.Second):
+		t.Fatal("job did not run")
+	}
+}
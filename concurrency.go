@@ -0,0 +1,175 @@
+package at
+
+import "time"
+
+// DefaultBusyDelay is how long DelayWhenBusy pushes an entry back unless
+// WithBusyDelay is given.
+const DefaultBusyDelay = 10 * time.Second
+
+// BusyPolicy decides what happens to an entry that is due while its
+// concurrency key already has as many jobs running as it allows.
+type BusyPolicy int
+
+const (
+	// WaitWhenBusy keeps the entry pending until a job with the key ends;
+	// waiting entries run in the order they became due.
+	WaitWhenBusy BusyPolicy = iota
+	// SkipWhenBusy does not run the entry and emits Skipped. A recurring
+	// entry moves on to its next time; the entries that depend on a one-shot
+	// entry are cancelled.
+	SkipWhenBusy
+	// DelayWhenBusy moves the entry back by the busy delay and emits
+	// Rescheduled.
+	DelayWhenBusy
+)
+
+// WithConcurrencyKey limits the jobs sharing key to max running at the same
+// time, counting the entry itself; with a max of 1 they never overlap. Each
+// entry is held to its own max. policy decides what happens when the entry
+// is due while the key is busy.
+func WithConcurrencyKey(key string, max int, policy BusyPolicy) JobOption {
+	return func(e *entry) {
+		if max < 1 {
+			max = 1
+		}
+		e.ConcurrencyKey = key
+		e.maxConcurrency = max
+		e.busy = policy
+	}
+}
+
+// WithBusyDelay sets how long DelayWhenBusy pushes the entry back. A
+// non-positive d restores DefaultBusyDelay.
+func WithBusyDelay(d time.Duration) JobOption {
+	return func(e *entry) {
+		e.busyDelay = d
+	}
+}
+
+// RunningWithKey returns the number of jobs with the concurrency key running.
+func (a *At) RunningWithKey(key string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.slots[key]
+}
+
+// acquire takes a slot of the concurrency key of e, if it has one. It
+// reports whether e may run. a.mu must be held.
+func (a *At) acquire(e *entry) bool {
+	if e.ConcurrencyKey == "" {
+		return true
+	}
+	if a.slots[e.ConcurrencyKey] >= e.maxConcurrency {
+		return false
+	}
+
+	a.slots[e.ConcurrencyKey]++
+	return true
+}
+
+// release gives back the slot taken by e and hands it to the first entry
+// waiting for the key, if that entry's max allows, so that no entry due
+// later can take it first. It returns the entry to start at now, if any.
+// a.mu must be held.
+func (a *At) release(e *entry, now time.Time) (next *entry) {
+	key := e.ConcurrencyKey
+	if key == "" {
+		return nil
+	}
+	if a.slots[key]--; a.slots[key] <= 0 {
+		delete(a.slots, key)
+	}
+
+	waiting := a.slotWaiters[key]
+	for len(waiting) > 0 {
+		w := waiting[0]
+		// Entries cancelled, moved or made to wait for dependencies since
+		// are stale.
+		if a.index[w.ID] != w || w.handle != nil || len(w.deps) > 0 {
+			waiting = waiting[1:]
+			continue
+		}
+		if !a.acquire(w) {
+			break
+		}
+
+		waiting = waiting[1:]
+		// The entry runs now, without counting the wait as lateness.
+		if w.At.Before(now) {
+			w.At = now
+		}
+		next = w
+		break
+	}
+	if len(waiting) == 0 {
+		delete(a.slotWaiters, key)
+	} else {
+		a.slotWaiters[key] = waiting
+	}
+	return next
+}
+
+// start dispatches e, due at now and holding a slot of its concurrency key,
+// unless the rate limits hold it back; its slot then passes on to the next
+// entry waiting for the key, and so on. It returns the events to emit and
+// the entry whose job is to run, if any. a.mu must be held.
+func (a *At) start(e *entry, now time.Time) (events []Event, run *entry) {
+	for e != nil {
+		ev, ok := a.throttle(e, now)
+		if !ok {
+			a.unindex(e)
+			a.active[e.ID] = e
+			return events, e
+		}
+		events = append(events, ev)
+		// The entry gives its slot back until it may run.
+		e = a.release(e, now)
+	}
+	return events, nil
+}
+
+// busy applies the busy policy to e, due at now while its concurrency key
+// is busy. It returns the events to emit and whether e must be requeued
+// once a.mu is released. a.mu must be held.
+func (a *At) busy(e *entry, now time.Time) (events []Event, requeue bool) {
+	// Whatever the policy, e does not run at the time it reserved tokens for.
+	a.refund(e)
+
+	switch e.busy {
+	case WaitWhenBusy:
+		e.handle = nil
+		a.slotWaiters[e.ConcurrencyKey] = append(a.slotWaiters[e.ConcurrencyKey], e)
+		return nil, false
+
+	case DelayWhenBusy:
+		delay := e.busyDelay
+		if delay <= 0 {
+			delay = DefaultBusyDelay
+		}
+		prev := e.At
+		e.At = now.Add(delay)
+		handle, err := a.entries.PushHandle(e)
+		if err != nil {
+			e.handle = nil
+			e.cancelErr = err
+			for _, d := range a.drop(e) {
+				events = append(events, d.cancelled())
+			}
+			return events, false
+		}
+		e.handle = handle
+		return []Event{{Type: Rescheduled, EntryID: e.ID, At: e.At, Previous: prev}}, false
+
+	default:
+		a.unindex(e)
+		events = append(events, Event{Type: Skipped, EntryID: e.ID, At: e.At})
+		if e.Schedule != nil {
+			return events, true
+		}
+		for _, d := range a.settle(e.ID, outcomeNotRun) {
+			events = append(events, d.cancelled())
+		}
+		return events, false
+	}
+}
@@ -0,0 +1,168 @@
+package at
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+// overlapJob records the highest number of its runs overlapping.
+type overlapJob struct {
+	running, peak int32
+	done          chan struct{}
+}
+
+func (j *overlapJob) Run() {
+	n := atomic.AddInt32(&j.running, 1)
+	for {
+		peak := atomic.LoadInt32(&j.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&j.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	atomic.AddInt32(&j.running, -1)
+	j.done <- struct{}{}
+}
+
+func TestConcurrencyKeyWait(t *testing.T) {
+	at := New()
+	job := &overlapJob{done: make(chan struct{}, 4)}
+	for i := 0; i < 4; i++ {
+		_, err := at.AddJob(time.Now(), job, WithConcurrencyKey("customer-1", 1, WaitWhenBusy))
+		assert.Nil(t, err)
+	}
+
+	at.Start()
+	defer at.Stop()
+	for i := 0; i < 4; i++ {
+		select {
+		case <-job.done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("job did not run")
+		}
+	}
+	assert.DeepEqual(t, atomic.LoadInt32(&job.peak), int32(1))
+	assert.DeepEqual(t, at.RunningWithKey("customer-1"), 0)
+}
+
+func TestConcurrencyKeyLimit(t *testing.T) {
+	at := New()
+	job := &overlapJob{done: make(chan struct{}, 6)}
+	for i := 0; i < 6; i++ {
+		at.AddJob(time.Now(), job, WithConcurrencyKey("reports", 2, WaitWhenBusy))
+	}
+
+	at.Start()
+	defer at.Stop()
+	for i := 0; i < 6; i++ {
+		select {
+		case <-job.done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("job did not run")
+		}
+	}
+	assert.True(t, atomic.LoadInt32(&job.peak) <= 2)
+}
+
+func TestConcurrencyKeySkip(t *testing.T) {
+	at := New()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	first, _ := at.AddFunc(time.Now(), func() {
+		close(started)
+		<-release
+	}, WithConcurrencyKey("k", 1, SkipWhenBusy))
+
+	sub := at.Subscribe(8)
+	defer sub.Close()
+	at.Start()
+	defer at.Stop()
+	<-started
+
+	second, _ := at.AddFunc(time.Now(), func() {}, WithConcurrencyKey("k", 1, SkipWhenBusy))
+	third, _ := at.AddFunc(time.Now().Add(time.Hour), func() {}, After(second))
+	for {
+		ev := nextEvent(t, sub)
+		if ev.Type == Skipped {
+			assert.DeepEqual(t, ev.EntryID, second)
+			break
+		}
+	}
+	ev := nextEvent(t, sub)
+	assert.DeepEqual(t, ev.Type, Cancelled)
+	assert.DeepEqual(t, ev.EntryID, third)
+
+	close(release)
+	_, ok := at.Entry(first)
+	assert.False(t, ok)
+}
+
+func TestConcurrencyKeyDelay(t *testing.T) {
+	at := New()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	at.AddFunc(time.Now(), func() {
+		close(started)
+		<-release
+	}, WithConcurrencyKey("k", 1, WaitWhenBusy))
+	defer close(release)
+
+	at.Start()
+	defer at.Stop()
+	<-started
+
+	sub := at.Subscribe(8)
+	defer sub.Close()
+	id, _ := at.AddFunc(time.Now(), func() {}, WithConcurrencyKey("k", 1, DelayWhenBusy), WithBusyDelay(time.Hour))
+	for {
+		ev := nextEvent(t, sub)
+		if ev.Type == Rescheduled {
+			assert.DeepEqual(t, ev.EntryID, id)
+			break
+		}
+	}
+	e, ok := at.Entry(id)
+	assert.True(t, ok)
+	assert.True(t, e.At.After(time.Now().Add(59*time.Minute)))
+	assert.DeepEqual(t, e.ConcurrencyKey, "k")
+}
+
+func TestConcurrencyKeyWaitOrder(t *testing.T) {
+	at := New()
+	sub := at.Subscribe(16)
+	defer sub.Close()
+
+	hold, holdFirst := make(chan struct{}), make(chan struct{})
+	due := wallClock(time.Now())
+	holder, _ := at.AddFunc(due, func() { <-hold }, WithConcurrencyKey("k", 1, WaitWhenBusy))
+	first, _ := at.AddFunc(due, func() { <-holdFirst }, WithConcurrencyKey("k", 1, WaitWhenBusy))
+	second, _ := at.AddFunc(due.Add(time.Millisecond), func() {}, WithConcurrencyKey("k", 1, WaitWhenBusy))
+
+	// The dispatcher is driven by hand: the first entry waits for the slot
+	// while the second, due earlier than the slot is freed, is not popped
+	// yet.
+	at.runDue(due)
+	time.Sleep(10 * time.Millisecond)
+	close(hold)
+	for {
+		ev := nextEvent(t, sub)
+		if ev.Type == Started && ev.EntryID != holder {
+			assert.DeepEqual(t, ev.EntryID, first)
+			break
+		}
+	}
+
+	// The second entry finds the slot taken and waits in turn.
+	at.runDue(wallClock(time.Now()))
+	close(holdFirst)
+	for {
+		ev := nextEvent(t, sub)
+		if ev.Type == Started {
+			assert.DeepEqual(t, ev.EntryID, second)
+			break
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package at
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression. Each field is a bit set of the
+// values it matches; the day fields also carry the L, W and # rules.
+type cronSchedule struct {
+	second, minute, hour, month uint64
+
+	dom      uint64
+	domRules []domRule
+	domStar  bool
+
+	dow      uint64
+	dowRules []dowRule
+	dowStar  bool
+
+	// The time zone the expression is evaluated in, or nil for the location
+	// of the time passed to Next.
+	location *time.Location
+}
+
+// domRule is a day of month given relative to the end of the month or to the
+// nearest weekday.
+type domRule struct {
+	last    bool // L or L-offset: the last day of the month, minus offset
+	offset  int
+	weekday bool // nW, or LW when last is set: the weekday nearest to day
+	day     int
+}
+
+// dowRule is a weekday given by its occurrence within the month.
+type dowRule struct {
+	weekday time.Weekday
+	nth     int // 1 to 5, or -1 for the last occurrence (nL)
+}
+
+// cronHorizon bounds the search for the next matching time, so that
+// expressions that never match, such as 30 February, end.
+const cronHorizon = 10 * 366
+
+type cronBounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondBounds = cronBounds{0, 59, nil}
+	minuteBounds = cronBounds{0, 59, nil}
+	hourBounds   = cronBounds{0, 23, nil}
+	domBounds    = cronBounds{1, 31, nil}
+	monthBounds  = cronBounds{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowBounds = cronBounds{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// ParseCron parses a cron expression into a Schedule. It accepts
+//
+//   - five fields: minute, hour, day of month, month and day of week;
+//   - six fields: a leading seconds field followed by the five above;
+//   - the descriptors @yearly, @annually, @monthly, @weekly, @daily,
+//     @midnight, @hourly and @every <duration>.
+//
+// Fields take values, ranges (a-b), steps (*/n, a-b/n, a/n) and lists
+// separated by commas; months and weekdays also take three-letter names, and
+// ? is the same as * in the day fields. The day of month field takes L (the
+// last day), L-n (n days before the last day), nW (the weekday nearest to day
+// n) and LW (the last weekday). The day of week field takes nL (the last
+// weekday n of the month) and n#k (the k-th weekday n of the month). When both
+// day fields are restricted, a day matching either runs the job.
+//
+// The expression is evaluated in the At's time zone unless it is prefixed
+// with CRON_TZ=<zone> or TZ=<zone>. Across DST transitions every wall clock
+// time fires once: a time repeated when the clocks go back fires at its first
+// occurrence, and a time skipped when they go forward fires at the moment of
+// the jump.
+func ParseCron(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	var loc *time.Location
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexAny(spec, " \t")
+		if i < 0 {
+			return nil, cronError(spec, "missing fields")
+		}
+		name := spec[strings.Index(spec, "=")+1 : i]
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil {
+			return nil, cronError(spec, "unknown time zone %q", name)
+		}
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil || d <= 0 {
+			return nil, cronError(spec, "invalid duration")
+		}
+		return Every(d), nil
+	}
+	if strings.HasPrefix(spec, "@") {
+		expanded, ok := cronDescriptors[spec]
+		if !ok {
+			return nil, cronError(spec, "unknown descriptor")
+		}
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, cronError(spec, "expected 5 or 6 fields, found %d", len(fields))
+	}
+
+	s := &cronSchedule{location: loc}
+	var err error
+	if s.second, err = parseCronField(fields[0], secondBounds); err != nil {
+		return nil, cronError(spec, "second: %v", err)
+	}
+	if s.minute, err = parseCronField(fields[1], minuteBounds); err != nil {
+		return nil, cronError(spec, "minute: %v", err)
+	}
+	if s.hour, err = parseCronField(fields[2], hourBounds); err != nil {
+		return nil, cronError(spec, "hour: %v", err)
+	}
+	if err = s.parseDom(fields[3]); err != nil {
+		return nil, cronError(spec, "day of month: %v", err)
+	}
+	if s.month, err = parseCronField(fields[4], monthBounds); err != nil {
+		return nil, cronError(spec, "month: %v", err)
+	}
+	if err = s.parseDow(fields[5]); err != nil {
+		return nil, cronError(spec, "day of week: %v", err)
+	}
+
+	return s, nil
+}
+
+func cronError(spec, format string, args ...interface{}) error {
+	return fmt.Errorf("at: cron expression %q: %s", spec, fmt.Sprintf(format, args...))
+}
+
+// parseCronField parses a comma separated list of values, ranges and steps.
+func parseCronField(field string, b cronBounds) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		v, _, err := parseCronItem(item, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= v
+	}
+	return bits, nil
+}
+
+// parseCronItem parses a value, range or step. It reports whether the item is
+// a bare wildcard, which leaves a day field unrestricted.
+func parseCronItem(item string, b cronBounds) (uint64, bool, error) {
+	rangePart, stepPart, hasStep := strings.Cut(item, "/")
+	step := 1
+	if hasStep {
+		var err error
+		if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+			return 0, false, fmt.Errorf("invalid step %q", stepPart)
+		}
+	}
+
+	var lo, hi int
+	star := false
+	if rangePart == "*" || rangePart == "?" {
+		lo, hi = b.min, b.max
+		star = step == 1
+	} else {
+		first, second, isRange := strings.Cut(rangePart, "-")
+		var err error
+		if lo, err = parseCronValue(first, b); err != nil {
+			return 0, false, err
+		}
+		hi = lo
+		if isRange {
+			if hi, err = parseCronValue(second, b); err != nil {
+				return 0, false, err
+			}
+		} else if hasStep {
+			hi = b.max
+		}
+		if hi < lo {
+			return 0, false, fmt.Errorf("invalid range %q", rangePart)
+		}
+	}
+
+	var bits uint64
+	for v := lo; v <= hi; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, star, nil
+}
+
+func parseCronValue(s string, b cronBounds) (int, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+	return v, nil
+}
+
+func (s *cronSchedule) parseDom(field string) error {
+	for _, item := range strings.Split(field, ",") {
+		upper := strings.ToUpper(item)
+		switch {
+		case upper == "L":
+			s.domRules = append(s.domRules, domRule{last: true})
+		case upper == "LW":
+			s.domRules = append(s.domRules, domRule{last: true, weekday: true})
+		case strings.HasPrefix(upper, "L-"):
+			n, err := strconv.Atoi(upper[2:])
+			if err != nil || n < 0 || n > 30 {
+				return fmt.Errorf("invalid offset %q", item)
+			}
+			s.domRules = append(s.domRules, domRule{last: true, offset: n})
+		case strings.HasSuffix(upper, "W"):
+			n, err := parseCronValue(upper[:len(upper)-1], domBounds)
+			if err != nil {
+				return err
+			}
+			s.domRules = append(s.domRules, domRule{weekday: true, day: n})
+		default:
+			bits, star, err := parseCronItem(item, domBounds)
+			if err != nil {
+				return err
+			}
+			s.dom |= bits
+			s.domStar = s.domStar || star
+		}
+	}
+	return nil
+}
+
+func (s *cronSchedule) parseDow(field string) error {
+	for _, item := range strings.Split(field, ",") {
+		upper := strings.ToUpper(item)
+		switch {
+		case strings.Contains(upper, "#"):
+			day, nth, _ := strings.Cut(upper, "#")
+			wd, err := parseCronValue(day, dowBounds)
+			if err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(nth)
+			if err != nil || n < 1 || n > 5 {
+				return fmt.Errorf("invalid occurrence %q", item)
+			}
+			s.dowRules = append(s.dowRules, dowRule{weekday: time.Weekday(wd % 7), nth: n})
+		case len(upper) > 1 && strings.HasSuffix(upper, "L"):
+			wd, err := parseCronValue(upper[:len(upper)-1], dowBounds)
+			if err != nil {
+				return err
+			}
+			s.dowRules = append(s.dowRules, dowRule{weekday: time.Weekday(wd % 7), nth: -1})
+		default:
+			bits, star, err := parseCronItem(item, dowBounds)
+			if err != nil {
+				return err
+			}
+			// Sunday is both 0 and 7.
+			if bits&(1<<7) != 0 {
+				bits = bits&^(1<<7) | 1
+			}
+			s.dow |= bits
+			s.dowStar = s.dowStar || star
+		}
+	}
+	return nil
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func weekdayOf(year int, month time.Month, day int) time.Weekday {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Weekday()
+}
+
+// nearestWeekday returns the weekday nearest to day without leaving the month.
+func nearestWeekday(year int, month time.Month, day int) int {
+	last := daysIn(year, month)
+	switch weekdayOf(year, month, day) {
+	case time.Saturday:
+		if day == 1 {
+			return day + 2
+		}
+		return day - 1
+	case time.Sunday:
+		if day == last {
+			return day - 2
+		}
+		return day + 1
+	}
+	return day
+}
+
+func (s *cronSchedule) domMatches(year int, month time.Month, day int) bool {
+	if s.dom&(1<<uint(day)) != 0 {
+		return true
+	}
+
+	last := daysIn(year, month)
+	for _, r := range s.domRules {
+		switch {
+		case r.last && r.weekday:
+			if day == nearestWeekday(year, month, last) {
+				return true
+			}
+		case r.last:
+			if day == last-r.offset {
+				return true
+			}
+		case r.weekday:
+			if r.day <= last && day == nearestWeekday(year, month, r.day) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *cronSchedule) dowMatches(year int, month time.Month, day int) bool {
+	wd := weekdayOf(year, month, day)
+	if s.dow&(1<<uint(wd)) != 0 {
+		return true
+	}
+
+	for _, r := range s.dowRules {
+		if r.weekday != wd {
+			continue
+		}
+		if r.nth < 0 && day+7 > daysIn(year, month) {
+			return true
+		}
+		if r.nth > 0 && (day-1)/7+1 == r.nth {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *cronSchedule) dayMatches(year int, month time.Month, day int) bool {
+	dom := s.domMatches(year, month, day)
+	dow := s.dowMatches(year, month, day)
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time later than t that matches the expression.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := s.location
+	if loc == nil {
+		loc = t.Location()
+	}
+	t = t.In(loc)
+
+	// Wall clock times map to instants in order, so the times of t's own day
+	// up to t's wall clock time can be skipped.
+	year, month, day := t.Date()
+	first := true
+	for i := 0; i < cronHorizon; i++ {
+		if s.month&(1<<uint(month)) == 0 {
+			year, month, day = nextMonth(year, month)
+			first = false
+			continue
+		}
+
+		if s.dayMatches(year, month, day) {
+			if next, ok := s.nextInDay(t, year, month, day, first, loc); ok {
+				return next
+			}
+		}
+
+		day++
+		if day > daysIn(year, month) {
+			year, month, day = nextMonth(year, month)
+		}
+		first = false
+	}
+
+	return time.Time{}
+}
+
+func nextMonth(year int, month time.Month) (int, time.Month, int) {
+	if month == time.December {
+		return year + 1, time.January, 1
+	}
+	return year, month + 1, 1
+}
+
+// nextInDay returns the first matching time of the given day later than t.
+func (s *cronSchedule) nextInDay(t time.Time, year int, month time.Month, day int, sameDay bool, loc *time.Location) (time.Time, bool) {
+	th, tm, ts := t.Clock()
+	for h := 0; h < 24; h++ {
+		if s.hour&(1<<uint(h)) == 0 || sameDay && h < th {
+			continue
+		}
+		for m := 0; m < 60; m++ {
+			if s.minute&(1<<uint(m)) == 0 || sameDay && h == th && m < tm {
+				continue
+			}
+			for sec := 0; sec < 60; sec++ {
+				if s.second&(1<<uint(sec)) == 0 || sameDay && h == th && m == tm && sec <= ts {
+					continue
+				}
+				next, _ := Wall(year, month, day, h, m, sec, loc).Resolve(GapAtTransition, OverlapEarlier)
+				if next.After(t) {
+					return next, true
+				}
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// CronFunc adds a func to the At to be run on the given cron expression. See
+// ParseCron for the syntax.
+func (a *At) CronFunc(spec string, cmd func(), opts ...JobOption) (EntryID, error) {
+	return a.CronJob(spec, FuncJob(cmd), opts...)
+}
+
+// CronJob adds a Job to the At to be run on the given cron expression. See
+// ParseCron for the syntax.
+func (a *At) CronJob(spec string, cmd Job, opts ...JobOption) (EntryID, error) {
+	s, err := ParseCron(spec)
+	if err != nil {
+		return 0, err
+	}
+	return a.ScheduleJob(s, cmd, opts...)
+}
@@ -0,0 +1,171 @@
+package at
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	return loc
+}
+
+func TestCronNext(t *testing.T) {
+	utc := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04:05", s)
+		assert.Nil(t, err)
+		return tm
+	}
+
+	tests := []struct {
+		spec, from, want string
+	}{
+		{"* * * * *", "2024-03-01 10:00:30", "2024-03-01 10:01:00"},
+		{"*/15 * * * * *", "2024-03-01 10:00:30", "2024-03-01 10:00:45"},
+		{"30 9 * * mon-fri", "2024-03-01 10:00:00", "2024-03-04 09:30:00"},
+		{"0 0 1,15 * *", "2024-03-01 00:00:00", "2024-03-15 00:00:00"},
+		{"0 12 * feb *", "2024-03-01 00:00:00", "2025-02-01 12:00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"@daily", "2024-03-01 10:00:00", "2024-03-02 00:00:00"},
+		{"@hourly", "2024-03-01 10:00:00", "2024-03-01 11:00:00"},
+		{"@weekly", "2024-03-01 10:00:00", "2024-03-03 00:00:00"},
+		{"@yearly", "2024-03-01 10:00:00", "2025-01-01 00:00:00"},
+		{"0 0 L * *", "2024-02-01 00:00:00", "2024-02-29 00:00:00"},
+		{"0 0 L-2 * *", "2024-04-01 00:00:00", "2024-04-28 00:00:00"},
+		// 15 June 2024 is a Saturday, 1 June 2024 is a Saturday too.
+		{"0 0 15W * *", "2024-06-01 00:00:00", "2024-06-14 00:00:00"},
+		{"0 0 1W * *", "2024-05-31 00:00:00", "2024-06-03 00:00:00"},
+		// 30 June 2024 is a Sunday.
+		{"0 0 LW * *", "2024-06-01 00:00:00", "2024-06-28 00:00:00"},
+		{"0 0 * * 5L", "2024-03-01 00:00:00", "2024-03-29 00:00:00"},
+		{"0 0 * * 1#2", "2024-03-01 00:00:00", "2024-03-11 00:00:00"},
+		{"0 0 * * 7", "2024-03-01 00:00:00", "2024-03-03 00:00:00"},
+		// Both day fields restricted: either matches.
+		{"0 0 13 * 5", "2024-03-01 00:00:00", "2024-03-08 00:00:00"},
+		{"0 0 13 * *", "2024-03-01 00:00:00", "2024-03-13 00:00:00"},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseCron(tt.spec)
+		assert.Nil(t, err)
+		got := s.Next(utc(tt.from))
+		if !got.Equal(utc(tt.want)) {
+			t.Errorf("%q: Next(%s) = %s, want %s", tt.spec, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestCronNever(t *testing.T) {
+	s, err := ParseCron("0 0 30 2 *")
+	assert.Nil(t, err)
+	assert.True(t, s.Next(time.Now()).IsZero())
+}
+
+func TestCronEvery(t *testing.T) {
+	s, err := ParseCron("@every 90s")
+	assert.Nil(t, err)
+	now := time.Now()
+	assert.DeepEqual(t, s.Next(now), now.Add(90*time.Second))
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * * mon#6",
+		"@fortnightly",
+		"@every never",
+		"CRON_TZ=Nowhere/Special * * * * *",
+	} {
+		_, err := ParseCron(spec)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestCronTimeZone(t *testing.T) {
+	tokyo := mustLocation(t, "Asia/Tokyo")
+	s, err := ParseCron("CRON_TZ=Asia/Tokyo 0 9 * * *")
+	assert.Nil(t, err)
+
+	from := time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC)
+	assert.True(t, s.Next(from).Equal(time.Date(2024, 3, 2, 9, 0, 0, 0, tokyo)))
+
+	// Without a prefix the location of the given time is used.
+	s, _ = ParseCron("0 9 * * *")
+	assert.True(t, s.Next(from).Equal(time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)))
+	assert.True(t, s.Next(from.In(tokyo)).Equal(time.Date(2024, 3, 2, 9, 0, 0, 0, tokyo)))
+}
+
+func TestCronDST(t *testing.T) {
+	ny := mustLocation(t, "America/New_York")
+
+	// Clocks go forward from 2:00 to 3:00 on 10 March 2024: 2:30 does not
+	// exist and fires at the jump, once.
+	s, _ := ParseCron("30 2 * * *")
+	next := s.Next(time.Date(2024, 3, 10, 0, 0, 0, 0, ny))
+	assert.True(t, next.Equal(time.Date(2024, 3, 10, 3, 0, 0, 0, ny)))
+	next = s.Next(next)
+	assert.True(t, next.Equal(time.Date(2024, 3, 11, 2, 30, 0, 0, ny)))
+
+	// Every 30 minutes across the jump: 1:30, then 3:00 (for 2:00 and 2:30).
+	s, _ = ParseCron("*/30 * * * *")
+	next = s.Next(time.Date(2024, 3, 10, 1, 0, 0, 0, ny))
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, next.Format("15:04 MST"))
+		next = s.Next(next)
+	}
+	assert.DeepEqual(t, got, []string{"01:30 EST", "03:00 EDT", "03:30 EDT", "04:00 EDT"})
+
+	// Clocks go back from 2:00 to 1:00 on 3 November 2024: 1:30 fires once,
+	// at its first occurrence.
+	s, _ = ParseCron("30 1 * * *")
+	next = s.Next(time.Date(2024, 11, 3, 0, 0, 0, 0, ny))
+	assert.DeepEqual(t, next.Format("15:04 MST"), "01:30 EDT")
+	next = s.Next(next)
+	assert.True(t, next.Equal(time.Date(2024, 11, 4, 1, 30, 0, 0, ny)))
+
+	// Hourly across the overlap: the repeated hour does not fire again.
+	s, _ = ParseCron("0 * * * *")
+	next = s.Next(time.Date(2024, 11, 3, 0, 30, 0, 0, ny))
+	got = nil
+	for i := 0; i < 3; i++ {
+		got = append(got, next.Format("15:04 MST"))
+		next = s.Next(next)
+	}
+	assert.DeepEqual(t, got, []string{"01:00 EDT", "02:00 EST", "03:00 EST"})
+}
+
+func TestCronJob(t *testing.T) {
+	at := New()
+	ran := make(chan struct{}, 10)
+	id, err := at.CronFunc("* * * * * *", func() {
+		ran <- struct{}{}
+	})
+	assert.Nil(t, err)
+
+	at.Start()
+	defer at.Stop()
+	select {
+	case <-ran:
+	case <-time.After(2 * time.Second):
+		t.Fatal("cron job did not run")
+	}
+	assert.True(t, at.Cancel(id))
+
+	_, err = at.CronFunc("not a cron", func() {})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,251 @@
+package at
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrUnknownDependency is returned when an entry depends on an entry that
+	// is neither pending nor running.
+	ErrUnknownDependency = errors.New("at: unknown dependency")
+
+	// ErrDependencyCycle is returned when a dependency would make entries
+	// wait for each other.
+	ErrDependencyCycle = errors.New("at: dependency cycle")
+
+	// ErrDependencyNotMet is the error of the Cancelled event of an entry
+	// whose dependency did not end as required.
+	ErrDependencyNotMet = errors.New("at: dependency not met")
+)
+
+// Condition is the outcome an entry requires of a dependency.
+type Condition int
+
+const (
+	// OnSuccess requires the dependency to run and succeed.
+	OnSuccess Condition = iota
+	// OnFailure requires the dependency to run and fail or panic.
+	OnFailure
+	// OnCompletion requires the dependency to run, whatever its outcome.
+	OnCompletion
+)
+
+func (c Condition) satisfiedBy(o outcome) bool {
+	switch c {
+	case OnSuccess:
+		return o == outcomeSucceeded
+	case OnFailure:
+		return o == outcomeFailed || o == outcomePanicked
+	default:
+		return o != outcomeNotRun
+	}
+}
+
+// After makes the entry wait for the given entries to succeed. At its time
+// it runs once all of them succeeded, or as soon as they do; if one of them
+// fails, panics, is missed or is cancelled, the entry is cancelled too, and
+// so on down the entries that depend on it. The entries must be pending or
+// running when the entry is added; a recurring entry satisfies the
+// dependency with its next run. Dependencies hold the first run of a
+// recurring entry only.
+func After(ids ...EntryID) JobOption {
+	return dependOn(OnSuccess, ids)
+}
+
+// AfterFailure makes the entry wait for the given entries to fail or panic,
+// as After does for success. It is meant for clean-up and alerting jobs.
+func AfterFailure(ids ...EntryID) JobOption {
+	return dependOn(OnFailure, ids)
+}
+
+// AfterCompletion makes the entry wait for the given entries to run,
+// whatever their outcome, as After does for success.
+func AfterCompletion(ids ...EntryID) JobOption {
+	return dependOn(OnCompletion, ids)
+}
+
+func dependOn(cond Condition, ids []EntryID) JobOption {
+	return func(e *entry) {
+		if e.deps == nil {
+			e.deps = make(map[EntryID]Condition)
+		}
+		for _, id := range ids {
+			e.deps[id] = cond
+		}
+	}
+}
+
+// AddDependency makes the pending entry id wait for the entry on as well,
+// like the After options do when an entry is added. It fails with
+// ErrDependencyCycle if on already waits for id, directly or not.
+func (a *At) AddDependency(id, on EntryID, cond Condition) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e, ok := a.index[id]
+	if !ok {
+		return fmt.Errorf("%w: entry %d is not pending", ErrUnknownDependency, id)
+	}
+	if _, ok := e.deps[on]; ok {
+		e.deps[on] = cond
+		return nil
+	}
+
+	deps := make(map[EntryID]Condition, len(e.deps)+1)
+	for dep, c := range e.deps {
+		deps[dep] = c
+	}
+	deps[on] = cond
+	if err := a.checkDeps(&entry{ID: id, deps: deps}); err != nil {
+		return err
+	}
+
+	e.deps = deps
+	a.dependents[on] = append(a.dependents[on], id)
+	return nil
+}
+
+// checkDeps reports whether the dependencies of e are pending or running and
+// free of cycles. a.mu must be held.
+func (a *At) checkDeps(e *entry) error {
+	for id := range e.deps {
+		if id == e.ID || (e.ID != 0 && a.waitsFor(id, e.ID)) {
+			return fmt.Errorf("%w: %d and %d", ErrDependencyCycle, e.ID, id)
+		}
+		_, pending := a.index[id]
+		_, running := a.active[id]
+		_, recurring := a.recurring[id]
+		if !pending && !running && !recurring {
+			return fmt.Errorf("%w %d", ErrUnknownDependency, id)
+		}
+	}
+	return nil
+}
+
+// waitsFor reports whether the entry from waits for the entry to, directly
+// or through other entries. a.mu must be held.
+func (a *At) waitsFor(from, to EntryID) bool {
+	seen := make(map[EntryID]bool)
+	stack := []EntryID{from}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == to {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if e, ok := a.index[id]; ok {
+			for dep := range e.deps {
+				stack = append(stack, dep)
+			}
+		}
+	}
+	return false
+}
+
+// finish frees the concurrency slot of e, which was dispatched and ran with
+// outcome o, or was missed, starting the next entry waiting for the slot,
+// and settles the entries waiting for e.
+func (a *At) finish(e *entry, o outcome) {
+	var (
+		events []Event
+		run    *entry
+	)
+	a.mu.Lock()
+	delete(a.active, e.ID)
+	now := wallClock(a.now())
+	if next := a.release(e, now); next != nil {
+		events, run = a.start(next, now)
+	}
+	cancelled := a.settle(e.ID, o)
+	a.mu.Unlock()
+
+	for _, ev := range events {
+		a.emit(ev)
+	}
+	a.emitCancelled(cancelled)
+	if run != nil {
+		go a.runWithRecovery(run)
+	}
+}
+
+// settle resolves the dependencies on the entry id, which ended with outcome
+// o. Entries whose dependencies are all met are queued to run; entries that
+// required another outcome are removed, and settled in turn. It returns the
+// removed entries. a.mu must be held.
+func (a *At) settle(id EntryID, o outcome) (cancelled []*entry) {
+	type settled struct {
+		id EntryID
+		o  outcome
+	}
+
+	now := wallClock(a.now())
+	work := []settled{{id, o}}
+	for len(work) > 0 {
+		s := work[0]
+		work = work[1:]
+
+		waiting := a.dependents[s.id]
+		delete(a.dependents, s.id)
+		for _, did := range waiting {
+			d, ok := a.index[did]
+			if !ok {
+				continue
+			}
+			cond, ok := d.deps[s.id]
+			if !ok {
+				continue
+			}
+
+			if !cond.satisfiedBy(s.o) {
+				d.cancelErr = fmt.Errorf("%w: entry %d", ErrDependencyNotMet, s.id)
+				a.remove(d)
+				cancelled = append(cancelled, d)
+				work = append(work, settled{d.ID, outcomeNotRun})
+				continue
+			}
+
+			delete(d.deps, s.id)
+			if len(d.deps) > 0 || d.handle != nil {
+				continue
+			}
+
+			// The entry is past its time: it runs now, without counting
+			// the wait as lateness.
+			if d.At.Before(now) {
+				d.At = now
+			}
+			handle, err := a.entries.PushHandle(d)
+			if err != nil {
+				d.cancelErr = err
+				a.remove(d)
+				cancelled = append(cancelled, d)
+				work = append(work, settled{d.ID, outcomeNotRun})
+				continue
+			}
+			d.handle = handle
+			a.notify()
+		}
+	}
+	return cancelled
+}
+
+// dependsOn returns the ids of the entries e still waits for, in order.
+func (e *entry) dependsOn() []EntryID {
+	if len(e.deps) == 0 {
+		return nil
+	}
+
+	ids := make([]EntryID, 0, len(e.deps))
+	for id := range e.deps {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,111 @@
+package at
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+func TestDependencyChain(t *testing.T) {
+	at := New()
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	step := func(name string) func() {
+		return func() {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}
+	}
+
+	// The upload is due first but waits for the export and the transform.
+	now := time.Now()
+	export, err := at.AddFunc(now.Add(100*time.Millisecond), step("export"))
+	assert.Nil(t, err)
+	transform, err := at.AddFunc(now.Add(50*time.Millisecond), step("transform"), After(export))
+	assert.Nil(t, err)
+	upload, err := at.AddFunc(now, step("upload"), After(transform))
+	assert.Nil(t, err)
+
+	e, _ := at.Entry(upload)
+	assert.DeepEqual(t, e.DependsOn, []EntryID{transform})
+
+	sub := at.Subscribe(16)
+	defer sub.Close()
+	at.Start()
+	defer at.Stop()
+	for done := 0; done < 3; {
+		if nextEvent(t, sub).Type == Succeeded {
+			done++
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.DeepEqual(t, order, []string{"export", "transform", "upload"})
+}
+
+func TestDependencyFailure(t *testing.T) {
+	at := New()
+	boom := errors.New("boom")
+	export, _ := at.AddFuncErr(time.Now().Add(50*time.Millisecond), func() error { return boom })
+	transform, _ := at.AddFunc(time.Now(), func() {}, After(export))
+	upload, _ := at.AddFunc(time.Now(), func() {}, After(transform))
+	alert, _ := at.AddFunc(time.Now(), func() {}, AfterFailure(export))
+	cleanup, _ := at.AddFunc(time.Now(), func() {}, AfterCompletion(transform))
+
+	sub := at.Subscribe(32)
+	defer sub.Close()
+	at.Start()
+	defer at.Stop()
+
+	cancelled := make(map[EntryID]error)
+	succeeded := make(map[EntryID]bool)
+	for len(cancelled) < 3 || !succeeded[alert] {
+		ev := nextEvent(t, sub)
+		switch ev.Type {
+		case Cancelled:
+			cancelled[ev.EntryID] = ev.Err
+		case Succeeded:
+			succeeded[ev.EntryID] = true
+		}
+	}
+
+	assert.True(t, errors.Is(cancelled[transform], ErrDependencyNotMet))
+	assert.True(t, errors.Is(cancelled[upload], ErrDependencyNotMet))
+	assert.True(t, errors.Is(cancelled[cleanup], ErrDependencyNotMet))
+	assert.Len(t, at.Entries(), 0)
+}
+
+func TestDependencyCancel(t *testing.T) {
+	at := New()
+	first, _ := at.AddFunc(time.Now().Add(time.Hour), func() {})
+	second, _ := at.AddFunc(time.Now().Add(time.Hour), func() {}, After(first))
+
+	assert.True(t, at.Cancel(first))
+	_, ok := at.Entry(second)
+	assert.False(t, ok)
+}
+
+func TestDependencyErrors(t *testing.T) {
+	at := New()
+	_, err := at.AddFunc(time.Now(), func() {}, After(42))
+	assert.True(t, errors.Is(err, ErrUnknownDependency))
+
+	a, _ := at.AddFunc(time.Now().Add(time.Hour), func() {})
+	b, _ := at.AddFunc(time.Now().Add(time.Hour), func() {}, After(a))
+	c, _ := at.AddFunc(time.Now().Add(time.Hour), func() {}, After(b))
+
+	assert.True(t, errors.Is(at.AddDependency(a, c, OnSuccess), ErrDependencyCycle))
+	assert.True(t, errors.Is(at.AddDependency(a, a, OnSuccess), ErrDependencyCycle))
+	assert.True(t, errors.Is(at.AddDependency(42, a, OnSuccess), ErrUnknownDependency))
+
+	assert.Nil(t, at.AddDependency(c, a, OnCompletion))
+	e, _ := at.Entry(c)
+	assert.DeepEqual(t, e.DependsOn, []EntryID{a, b})
+}
@@ -0,0 +1,168 @@
+package at
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType describes what happened to an entry or to the scheduler.
+type EventType int
+
+const (
+	// Added is emitted when an entry is scheduled.
+	Added EventType = iota + 1
+	// Cancelled is emitted when a pending entry is cancelled.
+	Cancelled
+	// Rescheduled is emitted when a pending entry is moved to a new time.
+	Rescheduled
+	// Started is emitted when a job begins running.
+	Started
+	// Succeeded is emitted when a job returns without error.
+	Succeeded
+	// Failed is emitted when an ErrJob returns an error.
+	Failed
+	// Panicked is emitted when a job panics.
+	Panicked
+	// Missed is emitted when a job is dispatched later than the missed
+	// tolerance allows and is therefore not run.
+	Missed
+	// Skipped is emitted when a job is not run because as many jobs with
+	// its concurrency key as it allows are running.
+	Skipped
+	// SchedulerStarted is emitted when the scheduler starts running.
+	SchedulerStarted
+	// SchedulerStopped is emitted when the scheduler stops.
+	SchedulerStopped
+	// ClockJumped is emitted when the wall clock moved by more or less than
+	// the time that elapsed, because it was corrected or the host was
+	// suspended. Duration holds the size of the jump, negative if the clock
+	// was set back.
+	ClockJumped
+)
+
+var eventTypeNames = map[EventType]string{
+	Added:            "added",
+	Cancelled:        "cancelled",
+	Rescheduled:      "rescheduled",
+	Started:          "started",
+	Succeeded:        "succeeded",
+	Failed:           "failed",
+	Panicked:         "panicked",
+	Missed:           "missed",
+	Skipped:          "skipped",
+	SchedulerStarted: "scheduler_started",
+	SchedulerStopped: "scheduler_stopped",
+	ClockJumped:      "clock_jumped",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// Event describes a change in the life cycle of an entry or of the scheduler.
+type Event struct {
+	Type EventType
+
+	// The time the event happened.
+	Time time.Time
+
+	// The entry the event refers to; zero for scheduler events.
+	EntryID EntryID
+
+	// The time the entry is scheduled to run.
+	At time.Time
+
+	// The time the entry was scheduled to run before it was rescheduled.
+	Previous time.Time
+
+	// How long the job ran, set for Succeeded, Failed and Panicked, or the
+	// size of the jump, set for ClockJumped.
+	Duration time.Duration
+
+	// The error returned by the job, set for Failed, or why the entry was
+	// cancelled, set for Cancelled unless it was cancelled on request.
+	Err error
+
+	// The value recovered from the job, set for Panicked.
+	Panic interface{}
+}
+
+// Subscription receives events from an At. Events are delivered on C without
+// ever blocking the scheduler; when C is full the event is dropped and
+// counted.
+type Subscription struct {
+	C <-chan Event
+
+	c       chan Event
+	bus     *eventBus
+	dropped uint64
+}
+
+// Dropped returns how many events were dropped because C was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close stops delivery of events and closes C.
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+type eventBus struct {
+	mu   sync.RWMutex
+	subs []*Subscription
+}
+
+func (b *eventBus) subscribe(size int) *Subscription {
+	c := make(chan Event, size)
+	s := &Subscription{C: c, c: c, bus: b}
+
+	b.mu.Lock()
+	b.subs = append(b.subs, s)
+	b.mu.Unlock()
+
+	return s
+}
+
+func (b *eventBus) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, sub := range b.subs {
+		if sub == s {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			close(s.c)
+			return
+		}
+	}
+}
+
+func (b *eventBus) publish(ev Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, s := range b.subs {
+		select {
+		case s.c <- ev:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// Subscribe returns a Subscription whose channel buffers up to size events.
+func (a *At) Subscribe(size int) *Subscription {
+	return a.events.subscribe(size)
+}
+
+func (a *At) emit(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = a.now()
+	}
+	a.events.publish(ev)
+}
@@ -0,0 +1,109 @@
+package at
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+func nextEvent(t *testing.T, s *Subscription) Event {
+	select {
+	case ev := <-s.C:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	return Event{}
+}
+
+func TestEventsJobLifecycle(t *testing.T) {
+	at := New()
+	s := at.Subscribe(16)
+	defer s.Close()
+
+	id, err := at.AddFunc(time.Now().Add(10*time.Millisecond), func() {})
+	assert.Nil(t, err)
+	at.Start()
+	defer at.Stop()
+
+	ev := nextEvent(t, s)
+	assert.DeepEqual(t, ev.Type, Added)
+	assert.DeepEqual(t, ev.EntryID, id)
+	assert.DeepEqual(t, nextEvent(t, s).Type, SchedulerStarted)
+	assert.DeepEqual(t, nextEvent(t, s).Type, Started)
+	assert.DeepEqual(t, nextEvent(t, s).Type, Succeeded)
+}
+
+func TestEventsFailedAndPanicked(t *testing.T) {
+	at := New()
+	s := at.Subscribe(16)
+	defer s.Close()
+
+	boom := errors.New("boom")
+	at.AddFuncErr(time.Now(), func() error { return boom })
+	at.Start()
+	defer at.Stop()
+
+	for ev := nextEvent(t, s); ev.Type != Failed; ev = nextEvent(t, s) {
+	}
+
+	at.AddFunc(time.Now(), func() { panic("oops") })
+	for {
+		ev := nextEvent(t, s)
+		if ev.Type == Panicked {
+			assert.DeepEqual(t, ev.Panic, "oops")
+			break
+		}
+	}
+}
+
+func TestEventsCancelAndReschedule(t *testing.T) {
+	at := New()
+	s := at.Subscribe(16)
+	defer s.Close()
+
+	id, _ := at.AddFunc(time.Now().Add(time.Hour), func() {})
+	nextEvent(t, s)
+
+	later := time.Now().Add(2 * time.Hour)
+	assert.True(t, at.Reschedule(id, later))
+	ev := nextEvent(t, s)
+	assert.DeepEqual(t, ev.Type, Rescheduled)
+	assert.True(t, ev.At.Equal(later))
+
+	assert.True(t, at.Cancel(id))
+	assert.DeepEqual(t, nextEvent(t, s).Type, Cancelled)
+	assert.False(t, at.Cancel(id))
+}
+
+func TestEventsMissed(t *testing.T) {
+	at := New(WithMissedTolerance(time.Millisecond))
+	s := at.Subscribe(16)
+	defer s.Close()
+
+	ran := make(chan struct{}, 1)
+	at.AddFunc(time.Now().Add(-time.Minute), func() { ran <- struct{}{} })
+	at.Start()
+	defer at.Stop()
+
+	for ev := nextEvent(t, s); ev.Type != Missed; ev = nextEvent(t, s) {
+	}
+	select {
+	case <-ran:
+		t.Fatal("missed job should not run")
+	default:
+	}
+}
+
+func TestSubscriptionDropsWhenFull(t *testing.T) {
+	at := New()
+	s := at.Subscribe(1)
+	defer s.Close()
+
+	at.AddFunc(time.Now().Add(time.Hour), func() {})
+	at.AddFunc(time.Now().Add(time.Hour), func() {})
+	assert.DeepEqual(t, s.Dropped(), uint64(1))
+}
@@ -0,0 +1,73 @@
+package at
+
+import "errors"
+
+// ErrDuplicateKey is returned when an entry is added with the key of a
+// pending entry under the RejectDuplicate policy.
+var ErrDuplicateKey = errors.New("at: duplicate key")
+
+// KeyPolicy decides what happens when an entry is added with the key of an
+// entry that is still pending.
+type KeyPolicy int
+
+const (
+	// RejectDuplicate keeps the pending entry and fails with ErrDuplicateKey.
+	RejectDuplicate KeyPolicy = iota
+	// ReplaceExisting cancels the pending entry and adds the new one.
+	ReplaceExisting
+	// KeepEarlier keeps whichever of the two entries runs first.
+	KeepEarlier
+	// KeepLater keeps whichever of the two entries runs last.
+	KeepLater
+)
+
+// WithKey gives the entry a unique key. Adding an entry whose key belongs to
+// a pending entry is resolved by policy; once an entry runs or is cancelled
+// its key is free again.
+func WithKey(key string, policy KeyPolicy) JobOption {
+	return func(e *entry) {
+		e.Key = key
+		e.keyPolicy = policy
+	}
+}
+
+// resolveKey decides whether e may be added given the pending entry holding
+// its key. It returns the entry to cancel in favour of e, or the id to
+// return instead of adding e. a.mu must be held.
+func (a *At) resolveKey(e *entry) (replaced *entry, kept EntryID, err error) {
+	if e.Key == "" {
+		return nil, 0, nil
+	}
+
+	id, ok := a.keys[e.Key]
+	if !ok {
+		return nil, 0, nil
+	}
+	existing := a.index[id]
+
+	switch e.keyPolicy {
+	case ReplaceExisting:
+		return existing, 0, nil
+	case KeepEarlier:
+		if e.At.Before(existing.At) {
+			return existing, 0, nil
+		}
+		return nil, existing.ID, nil
+	case KeepLater:
+		if e.At.After(existing.At) {
+			return existing, 0, nil
+		}
+		return nil, existing.ID, nil
+	default:
+		return nil, existing.ID, ErrDuplicateKey
+	}
+}
+
+// Key returns the id of the pending entry holding key.
+func (a *At) Key(key string) (EntryID, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id, ok := a.keys[key]
+	return id, ok
+}
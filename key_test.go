@@ -0,0 +1,69 @@
+package at
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+func TestKeyRejectDuplicate(t *testing.T) {
+	at := New()
+	when := time.Now().Add(time.Hour)
+	first, err := at.AddFunc(when, func() {}, WithKey("reminder", RejectDuplicate))
+	assert.Nil(t, err)
+
+	id, err := at.AddFunc(when, func() {}, WithKey("reminder", RejectDuplicate))
+	assert.DeepEqual(t, err, ErrDuplicateKey)
+	assert.DeepEqual(t, id, first)
+	assert.DeepEqual(t, at.entries.Len(), 1)
+}
+
+func TestKeyReplaceExisting(t *testing.T) {
+	at := New()
+	when := time.Now().Add(time.Hour)
+	first, _ := at.AddFunc(when, func() {}, WithKey("reminder", ReplaceExisting))
+	second, err := at.AddFunc(when.Add(time.Minute), func() {}, WithKey("reminder", ReplaceExisting))
+	assert.Nil(t, err)
+	assert.NotDeepEqual(t, second, first)
+
+	_, ok := at.Entry(first)
+	assert.False(t, ok)
+	id, ok := at.Key("reminder")
+	assert.True(t, ok)
+	assert.DeepEqual(t, id, second)
+}
+
+func TestKeyKeepEarlierAndLater(t *testing.T) {
+	at := New()
+	when := time.Now().Add(time.Hour)
+	first, _ := at.AddFunc(when, func() {}, WithKey("early", KeepEarlier))
+
+	id, err := at.AddFunc(when.Add(time.Minute), func() {}, WithKey("early", KeepEarlier))
+	assert.Nil(t, err)
+	assert.DeepEqual(t, id, first)
+
+	id, _ = at.AddFunc(when.Add(-time.Minute), func() {}, WithKey("early", KeepEarlier))
+	assert.NotDeepEqual(t, id, first)
+	e, _ := at.Entry(id)
+	assert.True(t, e.At.Equal(when.Add(-time.Minute)))
+
+	late, _ := at.AddFunc(when, func() {}, WithKey("late", KeepLater))
+	id, _ = at.AddFunc(when.Add(-time.Minute), func() {}, WithKey("late", KeepLater))
+	assert.DeepEqual(t, id, late)
+	id, _ = at.AddFunc(when.Add(time.Minute), func() {}, WithKey("late", KeepLater))
+	assert.NotDeepEqual(t, id, late)
+	assert.Len(t, at.Entries(), 2)
+}
+
+func TestKeyFreedAfterCancel(t *testing.T) {
+	at := New()
+	when := time.Now().Add(time.Hour)
+	first, _ := at.AddFunc(when, func() {}, WithKey("reminder", RejectDuplicate))
+	at.Cancel(first)
+
+	_, ok := at.Key("reminder")
+	assert.False(t, ok)
+	_, err := at.AddFunc(when, func() {}, WithKey("reminder", RejectDuplicate))
+	assert.Nil(t, err)
+}
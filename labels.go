@@ -0,0 +1,160 @@
+package at
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Labels are key/value pairs attached to an entry when it is added.
+type Labels map[string]string
+
+func (l Labels) clone() Labels {
+	if l == nil {
+		return nil
+	}
+
+	c := make(Labels, len(l))
+	for k, v := range l {
+		c[k] = v
+	}
+	return c
+}
+
+// WithLabels attaches labels to the entry.
+func WithLabels(l Labels) JobOption {
+	return func(e *entry) {
+		if e.Labels == nil {
+			e.Labels = make(Labels, len(l))
+		}
+		for k, v := range l {
+			e.Labels[k] = v
+		}
+	}
+}
+
+// Selector reports whether an entry with the given labels is selected.
+type Selector func(Labels) bool
+
+// MatchLabels returns a Selector that selects entries carrying all of the
+// given labels.
+func MatchLabels(l Labels) Selector {
+	l = l.clone()
+	return func(labels Labels) bool {
+		for k, v := range l {
+			if got, ok := labels[k]; !ok || got != v {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ParseSelector parses a comma separated list of requirements, all of which
+// must hold for an entry to be selected. A requirement is one of
+//
+//	key=value   the label is set to value
+//	key!=value  the label is not set to value
+//	key         the label is set
+//	!key        the label is not set
+func ParseSelector(s string) (Selector, error) {
+	var reqs []Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		req, err := parseRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+
+	return func(labels Labels) bool {
+		for _, req := range reqs {
+			if !req(labels) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func parseRequirement(s string) (Selector, error) {
+	if i := strings.Index(s, "!="); i >= 0 {
+		key, value := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+2:])
+		if key == "" {
+			return nil, fmt.Errorf("at: invalid selector requirement %q", s)
+		}
+		return func(labels Labels) bool {
+			got, ok := labels[key]
+			return !ok || got != value
+		}, nil
+	}
+
+	if i := strings.Index(s, "="); i >= 0 {
+		key, value := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+		if key == "" {
+			return nil, fmt.Errorf("at: invalid selector requirement %q", s)
+		}
+		return func(labels Labels) bool {
+			got, ok := labels[key]
+			return ok && got == value
+		}, nil
+	}
+
+	if strings.HasPrefix(s, "!") {
+		key := strings.TrimSpace(s[1:])
+		if key == "" {
+			return nil, fmt.Errorf("at: invalid selector requirement %q", s)
+		}
+		return func(labels Labels) bool {
+			_, ok := labels[key]
+			return !ok
+		}, nil
+	}
+
+	return func(labels Labels) bool {
+		_, ok := labels[s]
+		return ok
+	}, nil
+}
+
+// EntriesWhere returns a snapshot of the pending entries selected by sel,
+// ordered by time.
+func (a *At) EntriesWhere(sel Selector) []Entry {
+	var entries []Entry
+	for _, e := range a.Entries() {
+		if sel(e.Labels) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// CancelWhere cancels every pending entry selected by sel, and the entries
+// depending on them, and returns the ids of the cancelled entries.
+func (a *At) CancelWhere(sel Selector) []EntryID {
+	a.mu.Lock()
+	var cancelled []*entry
+	for _, e := range a.index {
+		if sel(e.Labels) {
+			cancelled = append(cancelled, a.drop(e)...)
+		}
+	}
+	a.mu.Unlock()
+
+	if len(cancelled) == 0 {
+		return nil
+	}
+
+	a.notify()
+	a.emitCancelled(cancelled)
+	ids := make([]EntryID, 0, len(cancelled))
+	for _, e := range cancelled {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
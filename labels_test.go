@@ -0,0 +1,59 @@
+package at
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+func TestParseSelector(t *testing.T) {
+	labels := Labels{"tenant": "42", "env": "prod"}
+
+	cases := []struct {
+		selector string
+		match    bool
+	}{
+		{"", true},
+		{"tenant=42", true},
+		{"tenant=42,env=prod", true},
+		{"tenant=43", false},
+		{"env!=dev", true},
+		{"env!=prod", false},
+		{"tenant", true},
+		{"region", false},
+		{"!region", true},
+		{"!tenant", false},
+	}
+	for _, c := range cases {
+		sel, err := ParseSelector(c.selector)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, sel(labels), c.match, c.selector)
+	}
+
+	_, err := ParseSelector("=42")
+	assert.NotNil(t, err)
+}
+
+func TestEntriesAndCancelWhere(t *testing.T) {
+	at := New()
+	when := time.Now().Add(time.Hour)
+	a, _ := at.AddFunc(when, func() {}, WithLabels(Labels{"tenant": "42"}))
+	b, _ := at.AddFunc(when.Add(time.Minute), func() {}, WithLabels(Labels{"tenant": "42", "kind": "mail"}))
+	c, _ := at.AddFunc(when, func() {}, WithLabels(Labels{"tenant": "7"}))
+
+	entries := at.EntriesWhere(MatchLabels(Labels{"tenant": "42"}))
+	assert.Len(t, entries, 2)
+	assert.DeepEqual(t, entries[0].ID, a)
+	assert.DeepEqual(t, entries[1].ID, b)
+
+	ids := at.CancelWhere(MatchLabels(Labels{"tenant": "42"}))
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	assert.DeepEqual(t, ids, []EntryID{a, b})
+
+	entries = at.Entries()
+	assert.Len(t, entries, 1)
+	assert.DeepEqual(t, entries[0].ID, c)
+	assert.Len(t, at.CancelWhere(MatchLabels(Labels{"tenant": "42"})), 0)
+}
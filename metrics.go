@@ -0,0 +1,239 @@
+package at
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type outcome int
+
+const (
+	outcomeSucceeded outcome = iota
+	outcomeFailed
+	outcomePanicked
+	// outcomeNotRun is the outcome of an entry that was cancelled or missed.
+	outcomeNotRun
+)
+
+var (
+	durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+	latenessBuckets = []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60, 300}
+)
+
+// histogram is a cumulative histogram in the Prometheus sense.
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+type queueMetrics struct {
+	executed  uint64
+	succeeded uint64
+	failed    uint64
+	panicked  uint64
+	missed    uint64
+	duration  *histogram
+	lateness  *histogram
+}
+
+type metrics struct {
+	mu     sync.Mutex
+	busy   int
+	queues map[string]*queueMetrics
+}
+
+// queue returns the metrics of the named queue; m.mu must be held.
+func (m *metrics) queue(name string) *queueMetrics {
+	if m.queues == nil {
+		m.queues = make(map[string]*queueMetrics)
+	}
+
+	q, ok := m.queues[name]
+	if !ok {
+		q = &queueMetrics{
+			duration: newHistogram(durationBuckets),
+			lateness: newHistogram(latenessBuckets),
+		}
+		m.queues[name] = q
+	}
+
+	return q
+}
+
+func (m *metrics) started(queue string, lateness time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if lateness < 0 {
+		lateness = 0
+	}
+	q := m.queue(queue)
+	q.executed++
+	q.lateness.observe(lateness.Seconds())
+	m.busy++
+}
+
+func (m *metrics) finished(queue string, d time.Duration, o outcome) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q := m.queue(queue)
+	switch o {
+	case outcomeSucceeded:
+		q.succeeded++
+	case outcomeFailed:
+		q.failed++
+	case outcomePanicked:
+		q.panicked++
+	}
+	q.duration.observe(d.Seconds())
+	m.busy--
+}
+
+func (m *metrics) missed(queue string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.queue(queue).missed++
+}
+
+// WriteMetrics writes the metrics of the scheduler to w in the Prometheus
+// text exposition format.
+func (a *At) WriteMetrics(w io.Writer) error {
+	pending := make(map[string]int)
+	a.mu.Lock()
+	for _, e := range a.index {
+		pending[e.Queue]++
+	}
+	a.mu.Unlock()
+
+	a.metrics.mu.Lock()
+	defer a.metrics.mu.Unlock()
+
+	names := make([]string, 0, len(pending)+len(a.metrics.queues))
+	for name := range pending {
+		names = append(names, name)
+	}
+	for name := range a.metrics.queues {
+		if _, ok := pending[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+
+	writeHeader(bw, "at_pending_jobs", "gauge", "Number of jobs waiting to run.")
+	for _, name := range names {
+		fmt.Fprintf(bw, "at_pending_jobs{queue=%s} %d\n", quoteLabel(name), pending[name])
+	}
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(*queueMetrics) uint64
+	}{
+		{"at_jobs_executed_total", "Number of jobs started.", func(q *queueMetrics) uint64 { return q.executed }},
+		{"at_jobs_succeeded_total", "Number of jobs that completed without error.", func(q *queueMetrics) uint64 { return q.succeeded }},
+		{"at_jobs_failed_total", "Number of jobs that returned an error.", func(q *queueMetrics) uint64 { return q.failed }},
+		{"at_jobs_panicked_total", "Number of jobs that panicked.", func(q *queueMetrics) uint64 { return q.panicked }},
+		{"at_jobs_missed_total", "Number of jobs skipped because they were dispatched too late.", func(q *queueMetrics) uint64 { return q.missed }},
+	}
+	for _, c := range counters {
+		writeHeader(bw, c.name, "counter", c.help)
+		for _, name := range names {
+			var v uint64
+			if q, ok := a.metrics.queues[name]; ok {
+				v = c.value(q)
+			}
+			fmt.Fprintf(bw, "%s{queue=%s} %d\n", c.name, quoteLabel(name), v)
+		}
+	}
+
+	writeHeader(bw, "at_job_duration_seconds", "histogram", "Time spent running jobs.")
+	for _, name := range names {
+		if q, ok := a.metrics.queues[name]; ok {
+			writeHistogram(bw, "at_job_duration_seconds", name, q.duration)
+		}
+	}
+
+	writeHeader(bw, "at_job_lateness_seconds", "histogram", "Delay between the scheduled time of a job and its start.")
+	for _, name := range names {
+		if q, ok := a.metrics.queues[name]; ok {
+			writeHistogram(bw, "at_job_lateness_seconds", name, q.lateness)
+		}
+	}
+
+	capacity := cap(a.workers)
+	writeHeader(bw, "at_workers_busy", "gauge", "Number of jobs currently running.")
+	fmt.Fprintf(bw, "at_workers_busy %d\n", a.metrics.busy)
+	writeHeader(bw, "at_workers_capacity", "gauge", "Maximum number of jobs running at once, 0 if unlimited.")
+	fmt.Fprintf(bw, "at_workers_capacity %d\n", capacity)
+	if capacity > 0 {
+		writeHeader(bw, "at_workers_saturation", "gauge", "Fraction of workers that are busy.")
+		fmt.Fprintf(bw, "at_workers_saturation %s\n", formatFloat(float64(a.metrics.busy)/float64(capacity)))
+	}
+
+	return bw.Flush()
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeHistogram(w io.Writer, name, queue string, h *histogram) {
+	queue = quoteLabel(queue)
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{queue=%s,le=%s} %d\n", name, queue, quoteLabel(formatFloat(b)), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{queue=%s,le=\"+Inf\"} %d\n", name, queue, h.count)
+	fmt.Fprintf(w, "%s_sum{queue=%s} %s\n", name, queue, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count{queue=%s} %d\n", name, queue, h.count)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// MetricsHandler returns an http.Handler that serves the metrics of the
+// scheduler in the Prometheus text exposition format.
+func (a *At) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := a.WriteMetrics(w); err != nil {
+			a.logf("at: writing metrics: %v", err)
+		}
+	})
+}
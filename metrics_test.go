@@ -0,0 +1,47 @@
+package at
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	at := New(WithWorkers(2))
+	s := at.Subscribe(16)
+	defer s.Close()
+
+	at.AddFunc(time.Now().Add(time.Hour), func() {}, InQueue("mail"))
+	at.AddFuncErr(time.Now(), func() error { return errors.New("boom") })
+	at.Start()
+	defer at.Stop()
+
+	for ev := nextEvent(t, s); ev.Type != Failed; ev = nextEvent(t, s) {
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, at.WriteMetrics(&buf))
+	out := buf.String()
+	assert.StringContains(t, out, `at_pending_jobs{queue="mail"} 1`)
+	assert.StringContains(t, out, `at_pending_jobs{queue="default"} 0`)
+	assert.StringContains(t, out, `at_jobs_executed_total{queue="default"} 1`)
+	assert.StringContains(t, out, `at_jobs_failed_total{queue="default"} 1`)
+	assert.StringContains(t, out, `at_job_lateness_seconds_count{queue="default"} 1`)
+	assert.StringContains(t, out, `at_job_duration_seconds_bucket{queue="default",le="+Inf"} 1`)
+	assert.StringContains(t, out, "at_workers_capacity 2")
+	assert.StringContains(t, out, "at_workers_saturation 0")
+}
+
+func TestMetricsHandler(t *testing.T) {
+	at := New()
+	rec := httptest.NewRecorder()
+	at.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.DeepEqual(t, rec.Code, 200)
+	assert.StringContains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.StringContains(t, rec.Body.String(), "# TYPE at_pending_jobs gauge")
+}
@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Delayed 代表可以被添加到延迟队列中的项
+type Delayed interface {
+	// Deadline 返回该项可以被弹出的时间
+	Deadline() time.Time
+}
+
+// TimerQueue 是按照Deadline弹出项的队列的公共接口，DelayQueue和TimingWheel都实现了该接口
+type TimerQueue[T Delayed] interface {
+	// PushHandle 将item添加到队列中，并返回指向该项的Handle
+	PushHandle(item T) (*Handle, error)
+	// Remove 删除h指向的项并返回它
+	Remove(h *Handle) (T, error)
+	// Update 将h指向的项替换为item
+	Update(h *Handle, item T) error
+	// PopExpired 弹出一个Deadline不晚于now的项，没有到期的项时返回false
+	PopExpired(now time.Time) (T, bool)
+	// NextDeadline 返回下一次需要调用PopExpired的时间，队列为空时返回false
+	NextDeadline() (time.Time, bool)
+	// Len 返回队列的长度
+	Len() int
+	// Dispose 释放当前队列
+	Dispose()
+}
+
+func delayedLess[T Delayed](a, b T) bool {
+	return a.Deadline().Before(b.Deadline())
+}
+
+// DelayQueue 是一个按照Deadline排序的优先队列，队首项只有在到期后才会被PopDue弹出
+type DelayQueue[T Delayed] struct {
+	*PriorityQueueOf[T]
+}
+
+// NewDelayQueue 创建一个新的延迟队列
+func NewDelayQueue[T Delayed](hint int, opts ...Option) *DelayQueue[T] {
+	return NewDelayQueueFunc[T](hint, delayedLess[T], opts...)
+}
+
+// NewDelayQueueFunc 创建一个新的延迟队列，项的顺序由less决定。
+// less必须首先按照Deadline排序，只能在Deadline相同时使用其他条件
+func NewDelayQueueFunc[T Delayed](hint int, less LessFunc[T], opts ...Option) *DelayQueue[T] {
+	return &DelayQueue[T]{
+		PriorityQueueOf: NewPriorityQueueOf[T](hint, less, opts...),
+	}
+}
+
+// Merge 将other中的所有项移入当前队列，参见PriorityQueueOf.Merge
+func (dq *DelayQueue[T]) Merge(other *DelayQueue[T]) error {
+	return dq.PriorityQueueOf.Merge(other.PriorityQueueOf)
+}
+
+// Split 将满足pred的项移入一个新的延迟队列，参见PriorityQueueOf.Split
+func (dq *DelayQueue[T]) Split(pred func(item T) bool) (*DelayQueue[T], error) {
+	pq, err := dq.PriorityQueueOf.Split(pred)
+	if err != nil {
+		return nil, err
+	}
+	return &DelayQueue[T]{PriorityQueueOf: pq}, nil
+}
+
+// PopExpired 弹出队首项，前提是它的Deadline不晚于now
+func (dq *DelayQueue[T]) PopExpired(now time.Time) (T, bool) {
+	pq := dq.PriorityQueueOf
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	var zero T
+	if pq.disposed || len(pq.items) == 0 || pq.items[0].Deadline().After(now) {
+		return zero, false
+	}
+
+	return pq.removeAt(0), true
+}
+
+// NextDeadline 返回队首项的Deadline
+func (dq *DelayQueue[T]) NextDeadline() (time.Time, bool) {
+	pq := dq.PriorityQueueOf
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	if len(pq.items) == 0 {
+		return time.Time{}, false
+	}
+
+	return pq.items[0].Deadline(), true
+}
+
+// PopDue 阻塞直到队首项到期或者ctx结束，然后弹出队首项。now返回当前时间，
+// 为nil时使用time.Now
+func (dq *DelayQueue[T]) PopDue(ctx context.Context, now func() time.Time) (T, error) {
+	if now == nil {
+		now = time.Now
+	}
+
+	var zero T
+	for {
+		pq := dq.PriorityQueueOf
+		pq.lock.Lock()
+		if pq.disposed {
+			pq.lock.Unlock()
+			return zero, ErrDisposed
+		}
+
+		var wait time.Duration = -1
+		if len(pq.items) > 0 {
+			wait = pq.items[0].Deadline().Sub(now())
+			if wait <= 0 {
+				item := pq.removeAt(0)
+				pq.lock.Unlock()
+				return item, nil
+			}
+		}
+
+		changed := pq.changed.wait()
+		pq.lock.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return zero, err
+		}
+	}
+}
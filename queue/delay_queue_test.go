@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+type mockDelayed time.Time
+
+func (m mockDelayed) Deadline() time.Time {
+	return time.Time(m)
+}
+
+func TestPopWait(t *testing.T) {
+	q := NewPriorityQueue(1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Push(mockItem(1))
+	}()
+
+	result, err := q.PopWait(context.Background())
+	assert.Nil(t, err)
+	assert.DeepEqual(t, result, mockItem(1))
+}
+
+func TestPopWaitContext(t *testing.T) {
+	q := NewPriorityQueue(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := q.PopWait(ctx)
+	assert.DeepEqual(t, err, context.DeadlineExceeded)
+}
+
+func TestPopWaitDisposed(t *testing.T) {
+	q := NewPriorityQueue(1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Dispose()
+	}()
+
+	_, err := q.PopWait(context.Background())
+	assert.DeepEqual(t, err, ErrDisposed)
+}
+
+func TestPopDue(t *testing.T) {
+	q := NewDelayQueue[mockDelayed](1)
+	start := time.Now()
+	q.Push(mockDelayed(start.Add(50 * time.Millisecond)))
+	q.Push(mockDelayed(start.Add(20 * time.Millisecond)))
+
+	result, err := q.PopDue(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, result, mockDelayed(start.Add(20*time.Millisecond)))
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+
+	// 新加入的项比队首项更早到期时，PopDue应当重新计算等待时间
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		q.Push(mockDelayed(time.Now()))
+	}()
+	result, err = q.PopDue(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.True(t, time.Time(result).Before(start.Add(50*time.Millisecond)))
+}
+
+func TestPopDueContext(t *testing.T) {
+	q := NewDelayQueue[mockDelayed](1)
+	q.Push(mockDelayed(time.Now().Add(time.Hour)))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := q.PopDue(ctx, nil)
+	assert.DeepEqual(t, err, context.DeadlineExceeded)
+	assert.DeepEqual(t, q.Len(), 1)
+}
+
+func TestPopDueClock(t *testing.T) {
+	q := NewDelayQueue[mockDelayed](1)
+	deadline := time.Now().Add(time.Hour)
+	q.Push(mockDelayed(deadline))
+
+	result, err := q.PopDue(context.Background(), func() time.Time { return deadline })
+	assert.Nil(t, err)
+	assert.DeepEqual(t, result, mockDelayed(deadline))
+}
+
+func BenchmarkPriorityPopWait(b *testing.B) {
+	q := NewPriorityQueue(b.N)
+	done := make(chan struct{})
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			q.PopWait(context.Background())
+		}
+		close(done)
+	}()
+
+	for i := 0; i < b.N; i++ {
+		q.Push(mockItem(i))
+	}
+
+	<-done
+}
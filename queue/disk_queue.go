@@ -0,0 +1,872 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Codec 负责项的序列化，DiskQueue通过它将项写入磁盘
+type Codec[T any] interface {
+	Marshal(item T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+// JSONCodec 使用encoding/json序列化项
+type JSONCodec[T any] struct{}
+
+// Marshal 将item编码为JSON
+func (JSONCodec[T]) Marshal(item T) ([]byte, error) {
+	return json.Marshal(item)
+}
+
+// Unmarshal 从JSON解码出一个项
+func (JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	var item T
+	err := json.Unmarshal(data, &item)
+	return item, err
+}
+
+const (
+	defaultMemoryLimit = 64 * 1024
+	defaultCacheSize   = 256
+
+	// maxSegments 段文件的数量超过该值时，将所有段文件合并为一个
+	maxSegments = 16
+
+	// maxRecord 单条记录的最大长度，用来识别损坏的长度字段
+	maxRecord = 1 << 30
+
+	walName    = "wal.log"
+	segmentExt = ".seg"
+)
+
+// WithMemoryLimit 设置DiskQueue在内存中保存的新项的最大数量，超过后这些项被排序写入一个新的段文件
+func WithMemoryLimit(n int) Option {
+	return func(o *options) {
+		o.memoryLimit = n
+	}
+}
+
+// WithCacheSize 设置DiskQueue从每个段文件预读到内存中的项的数量
+func WithCacheSize(n int) Option {
+	return func(o *options) {
+		o.cacheSize = n
+	}
+}
+
+// WithSync 使DiskQueue在每次写入日志后调用fsync。默认只保证进程崩溃时不丢数据，
+// 开启后在操作系统崩溃或者断电时也不会丢失已经返回的操作
+func WithSync() Option {
+	return func(o *options) {
+		o.sync = true
+	}
+}
+
+// 日志记录的类型
+const (
+	recSeq     byte = iota + 1 // 序号计数器
+	recSegment                 // 段文件的消费进度
+	recPush                    // 向内存缓冲区添加的项
+	recPop                     // 从内存缓冲区弹出的项
+)
+
+type diskEntry[T any] struct {
+	item T
+	seq  uint64
+}
+
+type cachedEntry[T any] struct {
+	diskEntry[T]
+	end int64
+}
+
+// segment 是一个按照优先级排序的段文件，只需要顺序读取
+type segment[T any] struct {
+	id        uint64
+	file      *os.File
+	reader    *bufio.Reader
+	pos       int64
+	offset    int64
+	remaining int
+	cache     []cachedEntry[T]
+}
+
+// DiskQueue 是一个持久化的优先队列，适合无法完全放入内存的大量项。
+//
+// 新添加的项先保存在内存缓冲区中，并追加到预写日志；缓冲区满后，其中的项被排序写入一个段文件。
+// 每个段文件只有队首的一小部分项被预读到内存中，Pop在内存缓冲区和各个段文件的队首之间选出
+// 优先级最高的项。重新打开时，DiskQueue根据日志恢复到最后一次成功返回的操作之后的状态。
+//
+// DiskQueue不支持Handle和容量限制
+type DiskQueue[T any] struct {
+	dir         string
+	codec       Codec[T]
+	less        LessFunc[T]
+	stable      bool
+	memoryLimit int
+	cacheSize   int
+	sync        bool
+
+	mem      *PriorityQueueOf[diskEntry[T]]
+	segments []*segment[T]
+	nextID   uint64
+	seq      uint64
+	size     int
+
+	wal    *os.File
+	walOps int
+	// err 是最近一次整理失败的原因
+	err error
+
+	lock     sync.Mutex
+	disposed bool
+}
+
+// OpenDiskQueue 打开dir中的持久化优先队列，dir不存在时会创建它。
+// codec用来序列化项，less报告a是否应该排在b之前，重新打开时必须使用相同的codec和less。
+// 日志末尾写了一半的记录会被丢弃，日志中间的记录损坏时返回ErrCorrupt
+func OpenDiskQueue[T any](dir string, codec Codec[T], less LessFunc[T], opts ...Option) (*DiskQueue[T], error) {
+	o := newOptions(opts)
+	if o.memoryLimit <= 0 {
+		o.memoryLimit = defaultMemoryLimit
+	}
+	if o.cacheSize <= 0 {
+		o.cacheSize = defaultCacheSize
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	dq := &DiskQueue[T]{
+		dir:         dir,
+		codec:       codec,
+		less:        less,
+		stable:      o.stable,
+		memoryLimit: o.memoryLimit,
+		cacheSize:   o.cacheSize,
+		sync:        o.sync,
+		nextID:      1,
+	}
+	dq.mem = dq.newBuffer()
+
+	if err := dq.recover(); err != nil {
+		dq.closeFiles()
+		return nil, err
+	}
+	return dq, nil
+}
+
+func (dq *DiskQueue[T]) newBuffer() *PriorityQueueOf[diskEntry[T]] {
+	return NewPriorityQueueOf[diskEntry[T]](1, dq.before)
+}
+
+// before 报告a是否应该排在b之前。稳定模式下，优先级相同的项按照加入队列的顺序排列
+func (dq *DiskQueue[T]) before(a, b diskEntry[T]) bool {
+	if dq.less(a.item, b.item) {
+		return true
+	}
+	if dq.stable && !dq.less(b.item, a.item) {
+		return a.seq < b.seq
+	}
+
+	return false
+}
+
+func (dq *DiskQueue[T]) path(name string) string {
+	return filepath.Join(dq.dir, name)
+}
+
+func segmentName(id uint64) string {
+	return fmt.Sprintf("%016x%s", id, segmentExt)
+}
+
+// recover 重放日志，恢复内存缓冲区和段文件的消费进度，并删除没有被引用的段文件
+func (dq *DiskQueue[T]) recover() error {
+	f, err := os.OpenFile(dq.path(walName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	dq.wal = f
+
+	type segState struct {
+		offset    int64
+		remaining int
+	}
+	segs := make(map[uint64]segState)
+	pushes := make(map[uint64][]byte)
+
+	r := &countingReader{r: bufio.NewReader(f)}
+	for {
+		start := r.n
+		payload, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.Is(err, ErrCorrupt) {
+			return err
+		}
+
+		fields, data, ok := decodeFields(payload)
+		if err != nil || !ok {
+			// 日志末尾不完整的记录来自崩溃时未完成的写入，直接丢弃；
+			// 损坏的记录之后还有数据时，丢弃它们会悄悄丢失已经返回的操作
+			tail, err := onlyZeros(r)
+			if err != nil {
+				return err
+			}
+			if !tail {
+				return fmt.Errorf("%w: log record at offset %d", ErrCorrupt, start)
+			}
+			break
+		}
+		switch payload[0] {
+		case recSeq:
+			if fields[0] > dq.seq {
+				dq.seq = fields[0]
+			}
+		case recSegment:
+			if fields[2] == 0 {
+				delete(segs, fields[0])
+			} else {
+				segs[fields[0]] = segState{offset: int64(fields[1]), remaining: int(fields[2])}
+			}
+		case recPush:
+			pushes[fields[0]] = data
+			if fields[0] > dq.seq {
+				dq.seq = fields[0]
+			}
+		case recPop:
+			delete(pushes, fields[0])
+		}
+	}
+
+	// 清理没有被引用的段文件，它们来自崩溃时未完成的写入或者已经消费完的段文件
+	names, err := os.ReadDir(dq.dir)
+	if err != nil {
+		return err
+	}
+	for _, de := range names {
+		name := de.Name()
+		if name == walName+".tmp" {
+			os.Remove(dq.path(name))
+			continue
+		}
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 16, 64)
+		if err != nil {
+			continue
+		}
+		if id >= dq.nextID {
+			dq.nextID = id + 1
+		}
+		if _, ok := segs[id]; !ok {
+			os.Remove(dq.path(name))
+		}
+	}
+
+	ids := make([]uint64, 0, len(segs))
+	for id := range segs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		s := segs[id]
+		seg, err := dq.openSegment(id, s.offset, s.remaining)
+		if err != nil {
+			return err
+		}
+		dq.segments = append(dq.segments, seg)
+		dq.size += s.remaining
+	}
+
+	for seq, data := range pushes {
+		item, err := dq.codec.Unmarshal(data)
+		if err != nil {
+			return err
+		}
+		dq.mem.push(diskEntry[T]{item: item, seq: seq}, nil)
+	}
+	dq.size += len(dq.mem.items)
+
+	if len(dq.mem.items) >= dq.memoryLimit {
+		return dq.flush()
+	}
+	// 重写日志，去掉末尾损坏的记录以及已经失效的记录
+	return dq.checkpoint()
+}
+
+func (dq *DiskQueue[T]) openSegment(id uint64, offset int64, remaining int) (*segment[T], error) {
+	f, err := os.Open(dq.path(segmentName(id)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: missing segment %d", ErrCorrupt, id)
+		}
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &segment[T]{
+		id:        id,
+		file:      f,
+		reader:    bufio.NewReader(f),
+		pos:       offset,
+		offset:    offset,
+		remaining: remaining,
+	}, nil
+}
+
+// fill 在预读的项用完后从段文件中读入下一批项
+func (dq *DiskQueue[T]) fill(seg *segment[T]) error {
+	if len(seg.cache) > 0 || seg.remaining == 0 {
+		return nil
+	}
+
+	n := min(dq.cacheSize, seg.remaining)
+	seg.cache = make([]cachedEntry[T], 0, n)
+	for i := 0; i < n; i++ {
+		payload, err := readRecord(seg.reader)
+		if err == io.EOF {
+			err = ErrCorrupt
+		}
+		if err != nil {
+			return fmt.Errorf("segment %d: %w", seg.id, err)
+		}
+
+		seq, k := binary.Uvarint(payload)
+		if k <= 0 {
+			return fmt.Errorf("segment %d: %w", seg.id, ErrCorrupt)
+		}
+		item, err := dq.codec.Unmarshal(payload[k:])
+		if err != nil {
+			return err
+		}
+
+		seg.pos += int64(recordSize(payload))
+		seg.cache = append(seg.cache, cachedEntry[T]{diskEntry: diskEntry[T]{item: item, seq: seq}, end: seg.pos})
+	}
+
+	return nil
+}
+
+// head 返回优先级最高的项以及它所在的段文件，段文件为nil表示该项位于内存缓冲区
+func (dq *DiskQueue[T]) head() (diskEntry[T], *segment[T], bool, error) {
+	var best diskEntry[T]
+	var from *segment[T]
+	found := false
+	if len(dq.mem.items) > 0 {
+		best, found = dq.mem.items[0], true
+	}
+
+	for _, seg := range dq.segments {
+		if err := dq.fill(seg); err != nil {
+			return best, nil, false, err
+		}
+		if len(seg.cache) == 0 {
+			continue
+		}
+		if !found || dq.before(seg.cache[0].diskEntry, best) {
+			best, from, found = seg.cache[0].diskEntry, seg, true
+		}
+	}
+
+	return best, from, found, nil
+}
+
+// log 将一条记录追加到日志中。写入失败时截掉写了一半的记录，使日志保持写入之前的状态
+func (dq *DiskQueue[T]) log(payload []byte) error {
+	off, err := dq.wal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	_, err = dq.wal.Write(encodeRecord(payload))
+	if err == nil && dq.sync {
+		err = dq.wal.Sync()
+	}
+	if err != nil {
+		dq.wal.Truncate(off)
+		dq.wal.Seek(off, io.SeekStart)
+		return err
+	}
+	dq.walOps++
+	return nil
+}
+
+// checkpoint 将当前的状态写入一个新的日志，并原子地替换旧的日志
+func (dq *DiskQueue[T]) checkpoint() error {
+	tmp := dq.path(walName + ".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		w := bufio.NewWriter(f)
+		if _, err := w.Write(encodeRecord(encodeFields(recSeq, nil, dq.seq))); err != nil {
+			return err
+		}
+		for _, seg := range dq.segments {
+			if _, err := w.Write(encodeRecord(encodeFields(recSegment, nil, seg.id, uint64(seg.offset), uint64(seg.remaining)))); err != nil {
+				return err
+			}
+		}
+		for _, e := range dq.mem.items {
+			data, err := dq.codec.Marshal(e.item)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(encodeRecord(encodeFields(recPush, data, e.seq))); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+		return os.Rename(tmp, dq.path(walName))
+	}()
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	syncDir(dq.dir)
+	dq.wal.Close()
+	dq.wal = f
+	dq.walOps = 0
+	return nil
+}
+
+// writeSegment 将entries按顺序写入一个新的段文件，并返回打开的段文件
+func (dq *DiskQueue[T]) writeSegment(next func() (diskEntry[T], bool, error)) (*segment[T], error) {
+	id := dq.nextID
+	dq.nextID++
+	name := dq.path(segmentName(id))
+
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	err = func() error {
+		w := bufio.NewWriter(f)
+		for {
+			e, ok, err := next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+
+			data, err := dq.codec.Marshal(e.item)
+			if err != nil {
+				return err
+			}
+			payload := binary.AppendUvarint(nil, e.seq)
+			if _, err := w.Write(encodeRecord(append(payload, data...))); err != nil {
+				return err
+			}
+			count++
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}()
+	f.Close()
+	if err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+
+	return dq.openSegment(id, 0, count)
+}
+
+// flush 将内存缓冲区中的项排序写入一个新的段文件
+func (dq *DiskQueue[T]) flush() error {
+	entries := make([]diskEntry[T], len(dq.mem.items))
+	copy(entries, dq.mem.items)
+	sort.Slice(entries, func(i, j int) bool { return dq.before(entries[i], entries[j]) })
+
+	i := 0
+	seg, err := dq.writeSegment(func() (diskEntry[T], bool, error) {
+		if i == len(entries) {
+			return diskEntry[T]{}, false, nil
+		}
+		i++
+		return entries[i-1], true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	dq.segments = append(dq.segments, seg)
+	old := dq.mem
+	dq.mem = dq.newBuffer()
+	if err := dq.checkpoint(); err != nil {
+		dq.segments = dq.segments[:len(dq.segments)-1]
+		dq.mem = old
+		dq.closeSegment(seg)
+		return err
+	}
+
+	if len(dq.segments) > maxSegments {
+		return dq.compact()
+	}
+	return nil
+}
+
+// compact 将所有段文件中剩余的项合并到一个新的段文件中
+func (dq *DiskQueue[T]) compact() error {
+	// 使用独立的读取位置进行合并，失败时不影响当前的状态
+	readers := make([]*segment[T], 0, len(dq.segments))
+	defer func() {
+		for _, r := range readers {
+			r.file.Close()
+		}
+	}()
+	for _, seg := range dq.segments {
+		r, err := dq.openSegment(seg.id, seg.offset, seg.remaining)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, r)
+	}
+
+	merged, err := dq.writeSegment(func() (diskEntry[T], bool, error) {
+		var best *segment[T]
+		for _, r := range readers {
+			if err := dq.fill(r); err != nil {
+				return diskEntry[T]{}, false, err
+			}
+			if len(r.cache) > 0 && (best == nil || dq.before(r.cache[0].diskEntry, best.cache[0].diskEntry)) {
+				best = r
+			}
+		}
+		if best == nil {
+			return diskEntry[T]{}, false, nil
+		}
+
+		e := best.cache[0].diskEntry
+		best.cache = best.cache[1:]
+		best.remaining--
+		return e, true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	old := dq.segments
+	dq.segments = []*segment[T]{merged}
+	if err := dq.checkpoint(); err != nil {
+		dq.segments = old
+		dq.closeSegment(merged)
+		return err
+	}
+
+	for _, seg := range old {
+		dq.closeSegment(seg)
+	}
+	return nil
+}
+
+// closeSegment 关闭并删除段文件
+func (dq *DiskQueue[T]) closeSegment(seg *segment[T]) {
+	seg.file.Close()
+	os.Remove(dq.path(segmentName(seg.id)))
+}
+
+// Push 将item添加到队列中。Push返回后，即使进程崩溃item也不会丢失；返回错误时item没有加入队列
+func (dq *DiskQueue[T]) Push(item T) error {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	if dq.disposed {
+		return ErrDisposed
+	}
+
+	data, err := dq.codec.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := dq.log(encodeFields(recPush, data, dq.seq+1)); err != nil {
+		return err
+	}
+
+	dq.seq++
+	dq.mem.push(diskEntry[T]{item: item, seq: dq.seq}, nil)
+	dq.size++
+
+	dq.tidy()
+	return nil
+}
+
+// Pop 弹出队首的项，队列为空时返回T的零值。Pop返回后，重新打开的队列中不再包含该项
+func (dq *DiskQueue[T]) Pop() (T, error) {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	var zero T
+	if dq.disposed {
+		return zero, ErrDisposed
+	}
+
+	e, seg, ok, err := dq.head()
+	if err != nil || !ok {
+		return zero, err
+	}
+
+	if seg == nil {
+		if err := dq.log(encodeFields(recPop, nil, e.seq)); err != nil {
+			return zero, err
+		}
+		dq.mem.removeAt(0)
+	} else {
+		end := seg.cache[0].end
+		if err := dq.log(encodeFields(recSegment, nil, seg.id, uint64(end), uint64(seg.remaining-1))); err != nil {
+			return zero, err
+		}
+		seg.cache = seg.cache[1:]
+		seg.offset = end
+		seg.remaining--
+		if seg.remaining == 0 {
+			dq.removeSegment(seg)
+		}
+	}
+	dq.size--
+
+	dq.tidy()
+	return e.item, nil
+}
+
+func (dq *DiskQueue[T]) removeSegment(seg *segment[T]) {
+	for i, s := range dq.segments {
+		if s == seg {
+			dq.segments = append(dq.segments[:i], dq.segments[i+1:]...)
+			break
+		}
+	}
+	dq.closeSegment(seg)
+}
+
+// tidy 在内存缓冲区已满时将其写入段文件，在日志中的记录过多时重写日志。
+// 操作此时已经写入日志，整理失败不影响操作的结果：失败的原因保存在err中，之后的操作会重试
+func (dq *DiskQueue[T]) tidy() {
+	switch {
+	case len(dq.mem.items) >= dq.memoryLimit:
+		dq.err = dq.flush()
+	case dq.walOps >= 2*dq.memoryLimit+maxSegments:
+		dq.err = dq.checkpoint()
+	default:
+		dq.err = nil
+	}
+}
+
+// Err 返回最近一次整理失败的原因。Push和Pop写入日志后即返回成功，之后将内存缓冲区写入段文件
+// 或者重写日志失败时只记录失败的原因，并在之后的操作中重试；整理成功后Err返回nil
+func (dq *DiskQueue[T]) Err() error {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	return dq.err
+}
+
+// Peek 返回队首的项，但是不会删除它。队列为空时返回T的零值
+func (dq *DiskQueue[T]) Peek() (T, error) {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	var zero T
+	if dq.disposed {
+		return zero, ErrDisposed
+	}
+	e, _, ok, err := dq.head()
+	if err != nil || !ok {
+		return zero, err
+	}
+	return e.item, nil
+}
+
+// Len 返回队列中项的数量
+func (dq *DiskQueue[T]) Len() int {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	return dq.size
+}
+
+// Empty 表明队列中是否包含任何项
+func (dq *DiskQueue[T]) Empty() bool {
+	return dq.Len() == 0
+}
+
+// Close 关闭队列使用的文件，队列中的项保留在磁盘上，可以通过OpenDiskQueue重新打开
+func (dq *DiskQueue[T]) Close() error {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	if dq.disposed {
+		return nil
+	}
+	dq.disposed = true
+	return dq.closeFiles()
+}
+
+func (dq *DiskQueue[T]) closeFiles() error {
+	var err error
+	for _, seg := range dq.segments {
+		seg.file.Close()
+	}
+	dq.segments = nil
+	if dq.wal != nil {
+		err = dq.wal.Close()
+	}
+	return err
+}
+
+// Disposed 表明队列是否已经关闭
+func (dq *DiskQueue[T]) Disposed() bool {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	return dq.disposed
+}
+
+// Dispose 关闭队列，与Close相同
+func (dq *DiskQueue[T]) Dispose() {
+	dq.Close()
+}
+
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// countingReader 记录已经读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// onlyZeros 报告r中剩余的数据是否全部为0。崩溃时已经扩展了长度但是没有写入数据的文件末尾全部为0
+func onlyZeros(r io.Reader) (bool, error) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false, nil
+			}
+		}
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// 记录的格式为：4字节长度 + 4字节CRC32 + 内容
+func encodeRecord(payload []byte) []byte {
+	buf := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(buf[:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(payload))
+	return append(buf, payload...)
+}
+
+func recordSize(payload []byte) int {
+	return 8 + len(payload)
+}
+
+// readRecord 读取一条记录，到达末尾时返回io.EOF，记录不完整或者校验失败时返回ErrCorrupt
+func readRecord(r io.Reader) ([]byte, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrCorrupt
+		}
+		return nil, err
+	}
+
+	n := binary.LittleEndian.Uint32(hdr[:4])
+	if n > maxRecord {
+		return nil, ErrCorrupt
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrCorrupt
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(hdr[4:]) {
+		return nil, ErrCorrupt
+	}
+
+	return payload, nil
+}
+
+// fieldCount 每种日志记录包含的整数字段的数量
+var fieldCount = map[byte]int{recSeq: 1, recSegment: 3, recPush: 1, recPop: 1}
+
+// encodeFields 编码一条日志记录：类型 + 若干整数字段 + 数据
+func encodeFields(typ byte, data []byte, fields ...uint64) []byte {
+	buf := []byte{typ}
+	for _, f := range fields {
+		buf = binary.AppendUvarint(buf, f)
+	}
+	return append(buf, data...)
+}
+
+func decodeFields(payload []byte) ([]uint64, []byte, bool) {
+	if len(payload) == 0 {
+		return nil, nil, false
+	}
+	n, ok := fieldCount[payload[0]]
+	if !ok {
+		return nil, nil, false
+	}
+
+	fields := make([]uint64, n)
+	rest := payload[1:]
+	for i := range fields {
+		v, k := binary.Uvarint(rest)
+		if k <= 0 {
+			return nil, nil, false
+		}
+		fields[i] = v
+		rest = rest[k:]
+	}
+	return fields, rest, true
+}
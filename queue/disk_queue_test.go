@@ -0,0 +1,229 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotoxu/assert"
+)
+
+func intLess(a, b int) bool {
+	return a < b
+}
+
+func openInts(t *testing.T, dir string, opts ...Option) *DiskQueue[int] {
+	q, err := OpenDiskQueue[int](dir, JSONCodec[int]{}, intLess, opts...)
+	assert.Nil(t, err)
+	return q
+}
+
+func popInts(t *testing.T, q *DiskQueue[int], n int) []int {
+	result := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		item, err := q.Pop()
+		assert.Nil(t, err)
+		result = append(result, item)
+	}
+	return result
+}
+
+func TestDiskQueueOrder(t *testing.T) {
+	q := openInts(t, t.TempDir(), WithMemoryLimit(8), WithCacheSize(3))
+	defer q.Close()
+
+	// 逆序添加，使项分布在多个段文件中，并触发段文件的合并
+	const n = 500
+	for i := n - 1; i >= 0; i-- {
+		assert.Nil(t, q.Push(i))
+	}
+	assert.DeepEqual(t, q.Len(), n)
+	item, err := q.Peek()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, item, 0)
+
+	for i := 0; i < n; i++ {
+		item, err := q.Pop()
+		assert.Nil(t, err)
+		assert.DeepEqual(t, item, i)
+	}
+	assert.True(t, q.Empty())
+
+	item, err = q.Pop()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, item, 0)
+
+	q.Close()
+	_, err = q.Peek()
+	assert.DeepEqual(t, err, ErrDisposed)
+}
+
+func TestDiskQueueRecover(t *testing.T) {
+	dir := t.TempDir()
+	q := openInts(t, dir, WithMemoryLimit(10), WithCacheSize(4))
+	for i := 0; i < 25; i++ {
+		q.Push(i * 2)
+	}
+	assert.DeepEqual(t, popInts(t, q, 5), []int{0, 2, 4, 6, 8})
+	q.Push(3)
+	assert.Nil(t, q.Close())
+
+	_, err := q.Pop()
+	assert.DeepEqual(t, err, ErrDisposed)
+
+	q = openInts(t, dir, WithMemoryLimit(10), WithCacheSize(4))
+	assert.DeepEqual(t, q.Len(), 21)
+	assert.DeepEqual(t, popInts(t, q, 3), []int{3, 10, 12})
+	q.Close()
+
+	q = openInts(t, dir, WithMemoryLimit(10), WithCacheSize(4))
+	defer q.Close()
+	assert.DeepEqual(t, q.Len(), 18)
+	item, _ := q.Pop()
+	assert.DeepEqual(t, item, 14)
+}
+
+func TestDiskQueueTornLog(t *testing.T) {
+	dir := t.TempDir()
+	q := openInts(t, dir)
+	q.Push(2)
+	q.Push(1)
+	q.wal.Close()
+
+	// 模拟崩溃时写了一半的记录
+	f, err := os.OpenFile(filepath.Join(dir, walName), os.O_WRONLY|os.O_APPEND, 0)
+	assert.Nil(t, err)
+	f.Write(encodeRecord(encodeFields(recPush, []byte("3"), 3))[:6])
+	f.Close()
+
+	q = openInts(t, dir)
+	defer q.Close()
+	assert.DeepEqual(t, q.Len(), 2)
+	assert.DeepEqual(t, popInts(t, q, 2), []int{1, 2})
+}
+
+func TestDiskQueueCorruptLog(t *testing.T) {
+	dir := t.TempDir()
+	q := openInts(t, dir)
+	q.Push(1)
+	q.Push(2)
+	q.Close()
+
+	// 日志末尾扩展了长度但是没有写入数据的部分可以丢弃
+	wal := filepath.Join(dir, walName)
+	f, err := os.OpenFile(wal, os.O_WRONLY|os.O_APPEND, 0)
+	assert.Nil(t, err)
+	f.Write(make([]byte, 100))
+	f.Close()
+	q = openInts(t, dir)
+	assert.DeepEqual(t, q.Len(), 2)
+	q.Close()
+
+	// 损坏的记录之后还有数据时不能悄悄丢弃它们
+	data, err := os.ReadFile(wal)
+	assert.Nil(t, err)
+	first := recordSize(encodeFields(recSeq, nil, 0))
+	data[first+8] ^= 0xff
+	assert.Nil(t, os.WriteFile(wal, data, 0o644))
+	_, err = OpenDiskQueue[int](dir, JSONCodec[int]{}, intLess)
+	assert.True(t, errors.Is(err, ErrCorrupt))
+}
+
+func TestDiskQueueFlushError(t *testing.T) {
+	dir := t.TempDir()
+	q := openInts(t, dir, WithMemoryLimit(2))
+
+	// 段文件无法创建时，Push仍然成功，失败的原因通过Err报告
+	blocker := filepath.Join(dir, segmentName(1))
+	assert.Nil(t, os.Mkdir(blocker, 0o755))
+	assert.Nil(t, q.Push(3))
+	assert.Nil(t, q.Push(1))
+	assert.NotNil(t, q.Err())
+	assert.DeepEqual(t, q.Len(), 2)
+
+	// 之后的操作重试整理
+	assert.Nil(t, os.Remove(blocker))
+	assert.Nil(t, q.Push(2))
+	assert.Nil(t, q.Err())
+	q.Close()
+
+	q = openInts(t, dir, WithMemoryLimit(2))
+	defer q.Close()
+	assert.DeepEqual(t, q.Len(), 3)
+	assert.DeepEqual(t, popInts(t, q, 3), []int{1, 2, 3})
+}
+
+func TestDiskQueuePeekError(t *testing.T) {
+	dir := t.TempDir()
+	q := openInts(t, dir, WithMemoryLimit(2))
+	q.Push(1)
+	q.Push(2)
+	q.Close()
+
+	// 段文件只在读取时校验
+	seg := filepath.Join(dir, segmentName(1))
+	data, err := os.ReadFile(seg)
+	assert.Nil(t, err)
+	data[len(data)-1] ^= 0xff
+	assert.Nil(t, os.WriteFile(seg, data, 0o644))
+
+	q = openInts(t, dir, WithMemoryLimit(2))
+	defer q.Close()
+	_, err = q.Peek()
+	assert.True(t, errors.Is(err, ErrCorrupt))
+}
+
+func TestDiskQueueOrphanSegment(t *testing.T) {
+	dir := t.TempDir()
+	q := openInts(t, dir)
+	q.Push(1)
+	q.Close()
+
+	// 崩溃前未完成写入的段文件不会被引用
+	orphan := filepath.Join(dir, segmentName(42))
+	assert.Nil(t, os.WriteFile(orphan, []byte("garbage"), 0o644))
+
+	q = openInts(t, dir)
+	defer q.Close()
+	_, err := os.Stat(orphan)
+	assert.True(t, os.IsNotExist(err))
+	assert.DeepEqual(t, popInts(t, q, 1), []int{1})
+}
+
+type diskTask struct {
+	Priority int
+	Name     string
+}
+
+func TestDiskQueueStable(t *testing.T) {
+	dir := t.TempDir()
+	less := func(a, b diskTask) bool { return a.Priority < b.Priority }
+	q, err := OpenDiskQueue[diskTask](dir, JSONCodec[diskTask]{}, less, Stable(), WithMemoryLimit(3))
+	assert.Nil(t, err)
+	defer q.Close()
+
+	names := []string{"a", "b", "c", "d", "e", "f", "g"}
+	for _, name := range names {
+		q.Push(diskTask{Priority: 1, Name: name})
+	}
+
+	for _, name := range names {
+		task, err := q.Pop()
+		assert.Nil(t, err)
+		assert.DeepEqual(t, task.Name, name)
+	}
+}
+
+func BenchmarkDiskQueue(b *testing.B) {
+	q, _ := OpenDiskQueue[int](b.TempDir(), JSONCodec[int]{}, intLess, WithMemoryLimit(4096))
+	defer q.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q.Push(b.N - i)
+	}
+	for i := 0; i < b.N; i++ {
+		q.Pop()
+	}
+}
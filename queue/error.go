@@ -5,4 +5,13 @@ import "errors"
 var (
 	// ErrDisposed 当在一个已经释放的队列上进行操作时返回该错误
 	ErrDisposed = errors.New("queue: disposed")
+
+	// ErrInvalidHandle 当Handle指向的项已经不在队列中时返回该错误
+	ErrInvalidHandle = errors.New("queue: invalid handle")
+
+	// ErrFull 当向一个已满的队列添加项时返回该错误
+	ErrFull = errors.New("queue: full")
+
+	// ErrCorrupt 当DiskQueue的数据文件损坏时返回该错误
+	ErrCorrupt = errors.New("queue: corrupt data")
 )
@@ -0,0 +1,40 @@
+package queue
+
+// Heap 是各种堆实现共同的接口，PriorityQueueOf和PairingHeap都实现了该接口
+type Heap[T any] interface {
+	Push(item T) error
+	PushHandle(item T) (*Handle, error)
+	Pop() (T, error)
+	Peek() T
+	Remove(h *Handle) (T, error)
+	Fix(h *Handle) error
+	Update(h *Handle, item T) error
+	Len() int
+	Empty() bool
+	Disposed() bool
+	Dispose()
+}
+
+// HeapKind 表示堆的实现算法
+type HeapKind int
+
+const (
+	// BinaryHeap 二叉堆，也是PriorityQueueOf的默认实现
+	BinaryHeap HeapKind = iota
+	// QuaternaryHeap 4叉堆，堆更浅，对缓存更友好
+	QuaternaryHeap
+	// PairingHeapKind 配对堆，插入和提高优先级的代价都很低
+	PairingHeapKind
+)
+
+// NewHeap 按照kind创建一个新的堆，hint是初始容量，配对堆会忽略hint
+func NewHeap[T any](kind HeapKind, hint int, less LessFunc[T], opts ...Option) Heap[T] {
+	switch kind {
+	case QuaternaryHeap:
+		return NewPriorityQueueOf[T](hint, less, append(opts, WithArity(4))...)
+	case PairingHeapKind:
+		return NewPairingHeap[T](less, opts...)
+	default:
+		return NewPriorityQueueOf[T](hint, less, opts...)
+	}
+}
@@ -0,0 +1,336 @@
+package queue
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+var heapKinds = []struct {
+	name string
+	kind HeapKind
+}{
+	{"binary", BinaryHeap},
+	{"4-ary", QuaternaryHeap},
+	{"pairing", PairingHeapKind},
+}
+
+func popAll(t *testing.T, h Heap[Item]) []int {
+	var result []int
+	for !h.Empty() {
+		item, err := h.Pop()
+		assert.Nil(t, err)
+		result = append(result, int(item.(mockItem)))
+	}
+	return result
+}
+
+func TestHeapOrder(t *testing.T) {
+	for _, hk := range heapKinds {
+		t.Run(hk.name, func(t *testing.T) {
+			h := NewHeap[Item](hk.kind, 1, itemLess)
+			var want []int
+			for i := 0; i < 200; i++ {
+				v := rand.IntN(50)
+				want = append(want, v)
+				assert.Nil(t, h.Push(mockItem(v)))
+			}
+			sort.Ints(want)
+
+			assert.DeepEqual(t, h.Len(), 200)
+			assert.DeepEqual(t, h.Peek(), mockItem(want[0]))
+			assert.DeepEqual(t, popAll(t, h), want)
+
+			item, err := h.Pop()
+			assert.Nil(t, err)
+			assert.Nil(t, item)
+		})
+	}
+}
+
+func TestHeapHandles(t *testing.T) {
+	for _, hk := range heapKinds {
+		t.Run(hk.name, func(t *testing.T) {
+			h := NewHeap[Item](hk.kind, 1, itemLess)
+			handles := make([]*Handle, 10)
+			for i := range handles {
+				handles[i], _ = h.PushHandle(mockItem(i * 10))
+			}
+
+			item, err := h.Remove(handles[3])
+			assert.Nil(t, err)
+			assert.DeepEqual(t, item, mockItem(30))
+			assert.False(t, handles[3].Queued())
+			_, err = h.Remove(handles[3])
+			assert.DeepEqual(t, err, ErrInvalidHandle)
+
+			// 提高和降低优先级
+			assert.Nil(t, h.Update(handles[9], mockItem(-1)))
+			assert.Nil(t, h.Update(handles[0], mockItem(55)))
+			assert.Nil(t, h.Update(handles[5], mockItem(5)))
+
+			assert.DeepEqual(t, popAll(t, h), []int{-1, 5, 10, 20, 40, 55, 60, 70, 80})
+			assert.False(t, handles[0].Queued())
+		})
+	}
+}
+
+func TestHeapFix(t *testing.T) {
+	for _, hk := range heapKinds {
+		t.Run(hk.name, func(t *testing.T) {
+			h := NewHeap[*mockTask](hk.kind, 1, func(a, b *mockTask) bool {
+				return a.priority < b.priority
+			})
+			tasks := make([]*mockTask, 8)
+			handles := make([]*Handle, len(tasks))
+			for i := range tasks {
+				tasks[i] = &mockTask{priority: i, name: fmt.Sprint(i)}
+				handles[i], _ = h.PushHandle(tasks[i])
+			}
+
+			tasks[0].priority = 100
+			assert.Nil(t, h.Fix(handles[0]))
+			tasks[6].priority = -1
+			assert.Nil(t, h.Fix(handles[6]))
+
+			var names []string
+			for !h.Empty() {
+				task, _ := h.Pop()
+				names = append(names, task.name)
+			}
+			assert.DeepEqual(t, names, []string{"6", "1", "2", "3", "4", "5", "7", "0"})
+		})
+	}
+}
+
+func TestHeapStable(t *testing.T) {
+	for _, hk := range heapKinds {
+		t.Run(hk.name, func(t *testing.T) {
+			h := NewHeap[*mockTask](hk.kind, 1, func(a, b *mockTask) bool {
+				return a.priority < b.priority
+			}, Stable())
+			for i := 0; i < 20; i++ {
+				h.Push(&mockTask{priority: i % 2, name: fmt.Sprint(i)})
+			}
+
+			var names []string
+			for !h.Empty() {
+				task, _ := h.Pop()
+				names = append(names, task.name)
+			}
+			assert.DeepEqual(t, names, []string{
+				"0", "2", "4", "6", "8", "10", "12", "14", "16", "18",
+				"1", "3", "5", "7", "9", "11", "13", "15", "17", "19",
+			})
+		})
+	}
+}
+
+func TestHeapStableUpdate(t *testing.T) {
+	for _, hk := range heapKinds {
+		t.Run(hk.name, func(t *testing.T) {
+			h := NewHeap[*mockTask](hk.kind, 1, func(a, b *mockTask) bool {
+				return a.priority < b.priority
+			}, Stable())
+			tasks := make([]*mockTask, 6)
+			handles := make([]*Handle, len(tasks))
+			for i := range tasks {
+				tasks[i] = &mockTask{priority: i % 2, name: fmt.Sprint(i)}
+				handles[i], _ = h.PushHandle(tasks[i])
+			}
+
+			// 优先级不变或者就地修改后更新，相同优先级的项仍然按照加入的顺序排列
+			assert.Nil(t, h.Update(handles[2], &mockTask{priority: 0, name: "2"}))
+			tasks[0].priority = 1
+			assert.Nil(t, h.Update(handles[0], tasks[0]))
+
+			var names []string
+			for !h.Empty() {
+				task, _ := h.Pop()
+				names = append(names, task.name)
+			}
+			assert.DeepEqual(t, names, []string{"2", "4", "0", "1", "3", "5"})
+		})
+	}
+}
+
+func TestHeapCapacity(t *testing.T) {
+	for _, hk := range heapKinds {
+		t.Run(hk.name, func(t *testing.T) {
+			h := NewHeap[Item](hk.kind, 1, itemLess, WithCapacity(2, RejectWhenFull))
+			assert.Nil(t, h.Push(mockItem(1)))
+			assert.Nil(t, h.Push(mockItem(2)))
+			assert.DeepEqual(t, h.Push(mockItem(3)), ErrFull)
+		})
+	}
+}
+
+func TestHeapDispose(t *testing.T) {
+	for _, hk := range heapKinds {
+		t.Run(hk.name, func(t *testing.T) {
+			h := NewHeap[Item](hk.kind, 1, itemLess)
+			handle, _ := h.PushHandle(mockItem(1))
+			h.Dispose()
+
+			assert.True(t, h.Disposed())
+			assert.False(t, handle.Queued())
+			assert.DeepEqual(t, h.Push(mockItem(2)), ErrDisposed)
+			_, err := h.Pop()
+			assert.DeepEqual(t, err, ErrDisposed)
+		})
+	}
+}
+
+func TestPairingHeapMerge(t *testing.T) {
+	a := NewPairingHeap[Item](itemLess)
+	b := NewPairingHeap[Item](itemLess)
+	for i := 0; i < 10; i++ {
+		a.Push(mockItem(i * 2))
+		b.Push(mockItem(i*2 + 1))
+	}
+	handle, _ := b.PushHandle(mockItem(-1))
+
+	assert.Nil(t, a.Merge(b))
+	assert.DeepEqual(t, a.Len(), 21)
+	assert.True(t, b.Empty())
+
+	// Handle在合并后仍然有效
+	item, err := a.Remove(handle)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, item, mockItem(-1))
+
+	want := make([]int, 20)
+	for i := range want {
+		want[i] = i
+	}
+	assert.DeepEqual(t, popAll(t, a), want)
+}
+
+func TestPairingHeapMergeBothWays(t *testing.T) {
+	a := NewPairingHeap[Item](itemLess)
+	b := NewPairingHeap[Item](itemLess)
+
+	// 两个方向同时合并不能死锁
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, pair := range [][2]*PairingHeap[Item]{{a, b}, {b, a}} {
+		wg.Add(1)
+		go func(dst, src *PairingHeap[Item]) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				src.Push(mockItem(i))
+				dst.Merge(src)
+			}
+		}(pair[0], pair[1])
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Merge deadlocked")
+	}
+	assert.DeepEqual(t, a.Len()+b.Len(), 2000)
+}
+
+func TestPairingHeapForeignHandle(t *testing.T) {
+	a := NewPairingHeap[Item](itemLess)
+	b := NewPairingHeap[Item](itemLess)
+	handle, _ := a.PushHandle(mockItem(1))
+	b.Push(mockItem(2))
+
+	_, err := b.Remove(handle)
+	assert.DeepEqual(t, err, ErrInvalidHandle)
+	assert.DeepEqual(t, b.Update(handle, mockItem(0)), ErrInvalidHandle)
+	assert.DeepEqual(t, b.Fix(handle), ErrInvalidHandle)
+	assert.DeepEqual(t, a.Len(), 1)
+	assert.DeepEqual(t, b.Len(), 1)
+
+	// 合并后Handle归属于新的堆
+	assert.Nil(t, b.Merge(a))
+	_, err = a.Remove(handle)
+	assert.DeepEqual(t, err, ErrInvalidHandle)
+	item, err := b.Remove(handle)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, item, mockItem(1))
+}
+
+func TestPairingHeapMergeEvict(t *testing.T) {
+	pq := NewPriorityQueueOf[Item](1, itemLess, WithCapacity(3, EvictWhenFull))
+	ph := NewPairingHeap[Item](itemLess, WithCapacity(3, EvictWhenFull))
+	for _, v := range []int{1, 5} {
+		pq.Push(mockItem(v))
+		ph.Push(mockItem(v))
+	}
+	otherPQ := NewPriorityQueueOf[Item](1, itemLess)
+	otherPH := NewPairingHeap[Item](itemLess)
+	for _, v := range []int{2, 3, 4} {
+		otherPQ.Push(mockItem(v))
+		otherPH.Push(mockItem(v))
+	}
+
+	// 两种堆在超出容量时都驱逐优先级最低的项
+	assert.Nil(t, pq.Merge(otherPQ))
+	assert.Nil(t, ph.Merge(otherPH))
+	assert.DeepEqual(t, popAll(t, pq), []int{1, 2, 3})
+	assert.DeepEqual(t, popAll(t, ph), []int{1, 2, 3})
+}
+
+func TestPairingHeapDeep(t *testing.T) {
+	// 按照优先级从低到高加入的项串成一条O(n)深的链
+	h := NewPairingHeap[Item](itemLess, WithCapacity(100000, EvictWhenFull))
+	var handles []*Handle
+	for i := 100000; i > 0; i-- {
+		handle, _ := h.PushHandle(mockItem(i))
+		handles = append(handles, handle)
+	}
+
+	// 查找优先级最低的项需要遍历整个堆
+	assert.Nil(t, h.Push(mockItem(0)))
+	assert.DeepEqual(t, h.Len(), 100000)
+	assert.False(t, handles[0].Queued())
+
+	h.Dispose()
+	for _, handle := range handles {
+		assert.False(t, handle.Queued())
+	}
+}
+
+func BenchmarkHeapPushPop(b *testing.B) {
+	for _, hk := range heapKinds {
+		b.Run(hk.name, func(b *testing.B) {
+			h := NewHeap[Item](hk.kind, b.N, itemLess)
+			for i := 0; i < b.N; i++ {
+				h.Push(mockItem(rand.IntN(b.N)))
+			}
+			for i := 0; i < b.N; i++ {
+				h.Pop()
+			}
+		})
+	}
+}
+
+func BenchmarkHeapDecreaseKey(b *testing.B) {
+	for _, hk := range heapKinds {
+		b.Run(hk.name, func(b *testing.B) {
+			h := NewHeap[Item](hk.kind, b.N, itemLess)
+			handles := make([]*Handle, b.N)
+			for i := range handles {
+				handles[i], _ = h.PushHandle(mockItem(i + b.N))
+			}
+
+			b.ResetTimer()
+			for i := range handles {
+				h.Update(handles[i], mockItem(b.N-i))
+			}
+		})
+	}
+}
@@ -0,0 +1,460 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+type pairingNode[T any] struct {
+	item   T
+	seq    uint64
+	handle *Handle
+	// heap 是节点所在的堆，用于拒绝其他堆的Handle
+	heap *PairingHeap[T]
+
+	// child指向第一个子节点，next指向下一个兄弟节点；
+	// prev指向前一个兄弟节点，对于第一个子节点则指向父节点
+	child, next, prev *pairingNode[T]
+}
+
+// PairingHeap 是一个配对堆。插入以及提高某一项的优先级的均摊时间复杂度都是O(1)，
+// 弹出队首项的均摊时间复杂度为O(log n)
+type PairingHeap[T any] struct {
+	root *pairingNode[T]
+	size int
+	less LessFunc[T]
+
+	stable   bool
+	seq      uint64
+	capacity int
+	full     FullPolicy
+	space    signal
+
+	lock     sync.Mutex
+	disposed bool
+}
+
+// NewPairingHeap 创建一个新的配对堆，less报告a是否应该排在b之前
+func NewPairingHeap[T any](less LessFunc[T], opts ...Option) *PairingHeap[T] {
+	o := newOptions(opts)
+	return &PairingHeap[T]{
+		less:     less,
+		stable:   o.stable,
+		capacity: o.capacity,
+		full:     o.full,
+	}
+}
+
+// before 报告节点a是否应该排在节点b之前
+func (ph *PairingHeap[T]) before(a, b *pairingNode[T]) bool {
+	if ph.less(a.item, b.item) {
+		return true
+	}
+	if ph.stable && !ph.less(b.item, a.item) {
+		return a.seq < b.seq
+	}
+
+	return false
+}
+
+// meld 合并两棵堆，返回新的根节点
+func (ph *PairingHeap[T]) meld(a, b *pairingNode[T]) *pairingNode[T] {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if ph.before(b, a) {
+		a, b = b, a
+	}
+
+	b.prev = a
+	b.next = a.child
+	if a.child != nil {
+		a.child.prev = b
+	}
+	a.child = b
+	a.next, a.prev = nil, nil
+	return a
+}
+
+// mergePairs 使用两趟合并算法将兄弟节点链表合并为一棵堆
+func (ph *PairingHeap[T]) mergePairs(first *pairingNode[T]) *pairingNode[T] {
+	if first == nil {
+		return nil
+	}
+
+	// 第一趟：从左到右两两合并，结果以相反的顺序串成链表
+	var merged *pairingNode[T]
+	for first != nil {
+		a, b := first, first.next
+		if b == nil {
+			first = nil
+		} else {
+			first = b.next
+		}
+		a.next, a.prev = nil, nil
+		if b != nil {
+			b.next, b.prev = nil, nil
+		}
+
+		pair := ph.meld(a, b)
+		pair.next = merged
+		merged = pair
+	}
+
+	// 第二趟：从右到左依次合并
+	var root *pairingNode[T]
+	for merged != nil {
+		next := merged.next
+		merged.next = nil
+		root = ph.meld(root, merged)
+		merged = next
+	}
+
+	return root
+}
+
+// cut 将以n为根的子树从堆中分离出来，n不能是根节点
+func (ph *PairingHeap[T]) cut(n *pairingNode[T]) {
+	if n.prev.child == n {
+		n.prev.child = n.next
+	} else {
+		n.prev.next = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	}
+	n.next, n.prev = nil, nil
+}
+
+// detach 将n从堆中删除
+func (ph *PairingHeap[T]) detach(n *pairingNode[T]) {
+	if n == ph.root {
+		ph.root = ph.mergePairs(n.child)
+	} else {
+		ph.cut(n)
+		ph.root = ph.meld(ph.root, ph.mergePairs(n.child))
+	}
+
+	n.child = nil
+	ph.size--
+	if n.handle != nil {
+		n.handle.index = -1
+	}
+	if ph.capacity > 0 {
+		ph.space.broadcast()
+	}
+}
+
+func (ph *PairingHeap[T]) push(n *pairingNode[T]) {
+	ph.seq++
+	n.seq = ph.seq
+	n.heap = ph
+	ph.root = ph.meld(ph.root, n)
+	ph.size++
+}
+
+// walk 对以root为根的堆中的每个节点调用fn。退化的堆可能深达O(n)层，因此使用显式的栈而不是递归
+func walk[T any](root *pairingNode[T], fn func(n *pairingNode[T])) {
+	if root == nil {
+		return
+	}
+
+	stack := []*pairingNode[T]{root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		fn(n)
+		if n.next != nil {
+			stack = append(stack, n.next)
+		}
+		if n.child != nil {
+			stack = append(stack, n.child)
+		}
+	}
+}
+
+// lowest 返回优先级最低的节点，它一定没有子节点
+func (ph *PairingHeap[T]) lowest() *pairingNode[T] {
+	var lowest *pairingNode[T]
+	walk(ph.root, func(n *pairingNode[T]) {
+		if n.child == nil && (lowest == nil || ph.before(lowest, n)) {
+			lowest = n
+		}
+	})
+
+	return lowest
+}
+
+// insert 按照容量策略将节点添加到堆中，调用时必须持有lock，阻塞时会暂时释放lock
+func (ph *PairingHeap[T]) insert(ctx context.Context, n *pairingNode[T]) (evicted T, ok bool, err error) {
+	for {
+		if ph.disposed {
+			return evicted, false, ErrDisposed
+		}
+		if ph.capacity <= 0 || ph.size < ph.capacity {
+			break
+		}
+
+		switch ph.full {
+		case EvictWhenFull:
+			lowest := ph.lowest()
+			if !ph.less(n.item, lowest.item) {
+				if n.handle != nil {
+					n.handle.index = -1
+				}
+				return n.item, true, nil
+			}
+			ph.detach(lowest)
+			evicted, ok = lowest.item, true
+
+		case BlockWhenFull:
+			space := ph.space.wait()
+			ph.lock.Unlock()
+			select {
+			case <-space:
+			case <-ctx.Done():
+			}
+			ph.lock.Lock()
+			if err := ctx.Err(); err != nil {
+				return evicted, false, err
+			}
+
+		default:
+			return evicted, false, ErrFull
+		}
+	}
+
+	ph.push(n)
+	return evicted, ok, nil
+}
+
+// Push 将item添加到堆中
+func (ph *PairingHeap[T]) Push(item T) error {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	_, _, err := ph.insert(context.Background(), &pairingNode[T]{item: item})
+	return err
+}
+
+// PushHandle 将item添加到堆中，并返回指向该项的Handle
+func (ph *PairingHeap[T]) PushHandle(item T) (*Handle, error) {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	n := &pairingNode[T]{item: item}
+	n.handle = &Handle{ref: n}
+	if _, _, err := ph.insert(context.Background(), n); err != nil {
+		return nil, err
+	}
+	return n.handle, nil
+}
+
+// Pop 弹出堆顶的项，堆为空时返回T的零值
+func (ph *PairingHeap[T]) Pop() (T, error) {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	var zero T
+	if ph.disposed {
+		return zero, ErrDisposed
+	}
+	if ph.root == nil {
+		return zero, nil
+	}
+
+	n := ph.root
+	ph.detach(n)
+	return n.item, nil
+}
+
+// Peek 返回堆顶的项，但是不会删除它。堆为空时返回T的零值
+func (ph *PairingHeap[T]) Peek() T {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	if ph.root == nil {
+		var zero T
+		return zero
+	}
+	return ph.root.item
+}
+
+// node 返回h指向的节点，h不属于当前堆时返回nil
+func (ph *PairingHeap[T]) node(h *Handle) *pairingNode[T] {
+	if h == nil || h.index < 0 {
+		return nil
+	}
+
+	n, ok := h.ref.(*pairingNode[T])
+	if !ok || n.handle != h || n.heap != ph {
+		return nil
+	}
+	return n
+}
+
+// Remove 删除h指向的项并返回它
+func (ph *PairingHeap[T]) Remove(h *Handle) (T, error) {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	var zero T
+	if ph.disposed {
+		return zero, ErrDisposed
+	}
+	n := ph.node(h)
+	if n == nil {
+		return zero, ErrInvalidHandle
+	}
+
+	ph.detach(n)
+	return n.item, nil
+}
+
+// fix 将节点的项替换为item并调整它的位置。只有item严格排在原来的项之前时，以n为根的子树才一定仍然有序，
+// 只需将子树切下并与根合并；优先级相同时子节点可能只是按照序号排在n之后，而原来的项被就地修改时
+// 无法得知优先级如何变化，这些情况都按照优先级降低处理
+func (ph *PairingHeap[T]) fix(n *pairingNode[T], item T) {
+	old := n.item
+	n.item = item
+	if !ph.less(item, old) {
+		ph.reinsert(n)
+		return
+	}
+
+	if n != ph.root {
+		ph.cut(n)
+		ph.root = ph.meld(ph.root, n)
+	}
+}
+
+// reinsert 将节点的子节点合并回堆中，再重新插入该节点
+func (ph *PairingHeap[T]) reinsert(n *pairingNode[T]) {
+	children := n.child
+	n.child = nil
+	if n == ph.root {
+		ph.root = ph.meld(n, ph.mergePairs(children))
+		return
+	}
+
+	ph.cut(n)
+	ph.root = ph.meld(ph.root, ph.mergePairs(children))
+	ph.root = ph.meld(ph.root, n)
+}
+
+// Fix 在h指向的项的优先级发生变化后，重新调整它在堆中的位置
+func (ph *PairingHeap[T]) Fix(h *Handle) error {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	if ph.disposed {
+		return ErrDisposed
+	}
+	n := ph.node(h)
+	if n == nil {
+		return ErrInvalidHandle
+	}
+
+	// 无法得知原来的优先级，按照优先级降低的情况处理
+	ph.reinsert(n)
+	return nil
+}
+
+// Update 将h指向的项替换为item，并调整它在堆中的位置
+func (ph *PairingHeap[T]) Update(h *Handle, item T) error {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	if ph.disposed {
+		return ErrDisposed
+	}
+	n := ph.node(h)
+	if n == nil {
+		return ErrInvalidHandle
+	}
+
+	ph.fix(n, item)
+	return nil
+}
+
+// Merge 将other中的所有项移入当前堆，合并后other为空。两棵树的合并只需O(1)，
+// 但需要遍历other中的节点将它们归入当前堆，因此总的时间复杂度为O(n)，n为other中项的数量。
+// 指向other中的项的Handle在合并后指向当前堆中的相同项。
+// 合并后超出容量时，策略为EvictWhenFull则驱逐优先级最低的项，否则返回ErrFull且不移动任何项
+func (ph *PairingHeap[T]) Merge(other *PairingHeap[T]) error {
+	if ph == other {
+		return nil
+	}
+
+	unlock := lockPair(&ph.lock, &other.lock)
+	defer unlock()
+
+	if ph.disposed || other.disposed {
+		return ErrDisposed
+	}
+	if ph.capacity > 0 && ph.size+other.size > ph.capacity && ph.full != EvictWhenFull {
+		return ErrFull
+	}
+
+	// 稳定模式下保持合并进来的项之间的相对顺序，并排在当前堆中相同优先级的项之后
+	walk(other.root, func(n *pairingNode[T]) {
+		n.heap = ph
+		if ph.stable {
+			n.seq += ph.seq
+		}
+	})
+	if ph.stable {
+		ph.seq += other.seq
+	}
+
+	ph.root = ph.meld(ph.root, other.root)
+	ph.size += other.size
+	other.root, other.size = nil, 0
+	for ph.capacity > 0 && ph.size > ph.capacity {
+		ph.detach(ph.lowest())
+	}
+	if other.capacity > 0 {
+		other.space.broadcast()
+	}
+	return nil
+}
+
+// Len 返回堆中项的数量
+func (ph *PairingHeap[T]) Len() int {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	return ph.size
+}
+
+// Empty 表明堆中是否包含任何项
+func (ph *PairingHeap[T]) Empty() bool {
+	return ph.Len() == 0
+}
+
+// Disposed 表明堆是否已经释放
+func (ph *PairingHeap[T]) Disposed() bool {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	return ph.disposed
+}
+
+// Dispose 释放当前堆
+func (ph *PairingHeap[T]) Dispose() {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	walk(ph.root, func(n *pairingNode[T]) {
+		if n.handle != nil {
+			n.handle.index = -1
+		}
+	})
+
+	ph.root, ph.size = nil, 0
+	ph.disposed = true
+	ph.space.broadcast()
+}
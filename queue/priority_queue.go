@@ -1,7 +1,11 @@
 package queue
 
 import (
+	"context"
+	"iter"
 	"sync"
+	"sync/atomic"
+	"unsafe"
 )
 
 // Item 代表可以被添加到优先队列中的项
@@ -11,93 +15,670 @@ type Item interface {
 	Compare(other Item) int
 }
 
-type priorityItems []Item
+// LessFunc 报告a是否应该排在b之前
+type LessFunc[T any] func(a, b T) bool
 
-func (items *priorityItems) swap(i, j int) {
-	(*items)[i], (*items)[j] = (*items)[j], (*items)[i]
+type priorityItems[T any] []T
+
+// Handle 指向优先队列中的某一项，用于在O(log n)时间内删除或者调整该项
+type Handle struct {
+	index int
+	ref   interface{}
+}
+
+// Queued 表明handle指向的项是否仍在队列中
+func (h *Handle) Queued() bool {
+	return h.index >= 0
+}
+
+// PriorityQueueOf 是一个元素类型为T的优先队列，元素的顺序由less决定
+type PriorityQueueOf[T any] struct {
+	items    priorityItems[T]
+	handles  []*Handle
+	less     LessFunc[T]
+	arity    int
+	stable   bool
+	seq      uint64
+	seqs     []uint64
+	shared   *atomic.Uint64
+	capacity int
+	full     FullPolicy
+	changed  signal
+	space    signal
+	lock     sync.Mutex
+	disposed bool
 }
 
-func (items *priorityItems) pop() Item {
-	size := len(*items)
+// PriorityQueue 是一个优先队列，其中的项通过Item.Compare排序
+type PriorityQueue = PriorityQueueOf[Item]
+
+// before 报告i处的项是否应该排在j处的项之前。稳定模式下，优先级相同的项按照加入队列的顺序排列
+func (pq *PriorityQueueOf[T]) before(i, j int) bool {
+	if pq.less(pq.items[i], pq.items[j]) {
+		return true
+	}
+	if pq.stable && !pq.less(pq.items[j], pq.items[i]) {
+		return pq.seqs[i] < pq.seqs[j]
+	}
+
+	return false
+}
+
+func (pq *PriorityQueueOf[T]) swap(i, j int) {
+	pq.items[i], pq.items[j] = pq.items[j], pq.items[i]
+	pq.handles[i], pq.handles[j] = pq.handles[j], pq.handles[i]
+	if pq.stable {
+		pq.seqs[i], pq.seqs[j] = pq.seqs[j], pq.seqs[i]
+	}
+	if pq.handles[i] != nil {
+		pq.handles[i].index = i
+	}
+	if pq.handles[j] != nil {
+		pq.handles[j].index = j
+	}
+}
+
+// up 将index处的项向堆顶移动，直到满足堆的性质
+func (pq *PriorityQueueOf[T]) up(index int) {
+	for index > 0 {
+		parent := (index - 1) / pq.arity
+		if !pq.before(index, parent) {
+			break
+		}
 
-	items.swap(size-1, 0)
-	item := (*items)[size-1]
-	(*items)[size-1], *items = nil, (*items)[:size-1]
+		pq.swap(index, parent)
+		index = parent
+	}
+}
 
-	index := 0
-	childL, childR := 2*index+1, 2*index+2
-	for len(*items) > childL {
-		child := childL
-		if len(*items) > childR && (*items)[childR].Compare((*items)[childL]) < 0 {
-			child = childR
+// down 将index处的项向堆底移动，直到满足堆的性质。返回该项是否发生了移动
+func (pq *PriorityQueueOf[T]) down(index int) bool {
+	start := index
+	for {
+		first := pq.arity*index + 1
+		if first >= len(pq.items) {
+			break
 		}
 
-		if (*items)[child].Compare((*items)[index]) < 0 {
-			items.swap(index, child)
+		child := first
+		for c := first + 1; c < first+pq.arity && c < len(pq.items); c++ {
+			if pq.before(c, child) {
+				child = c
+			}
+		}
 
-			index = child
-			childL, childR = 2*index+1, 2*index+2
-		} else {
+		if !pq.before(child, index) {
 			break
 		}
+
+		pq.swap(index, child)
+		index = child
 	}
 
-	return item
+	return index > start
 }
 
-func (items *priorityItems) push(item Item) {
-	*items = append(*items, item)
+// nextSeq 返回下一个加入队列的项的序号。分片队列的各个分片共用shared中的序号，
+// 使不同分片中的项也可以比较先后
+func (pq *PriorityQueueOf[T]) nextSeq() uint64 {
+	if pq.shared != nil {
+		return pq.shared.Add(1)
+	}
 
-	index := len(*items) - 1
-	parent := int((index - 1) / 2)
-	for parent >= 0 && (*items)[parent].Compare(item) > 0 {
-		items.swap(index, parent)
+	pq.seq++
+	return pq.seq
+}
 
-		index = parent
-		parent = int((index - 1) / 2)
+func (pq *PriorityQueueOf[T]) push(item T, h *Handle) {
+	pq.items = append(pq.items, item)
+	pq.handles = append(pq.handles, h)
+	if pq.stable {
+		pq.seqs = append(pq.seqs, pq.nextSeq())
+	}
+	if h != nil {
+		h.index = len(pq.items) - 1
 	}
+
+	pq.up(len(pq.items) - 1)
 }
 
-// PriorityQueue 是一个优先队列
-type PriorityQueue struct {
-	items       priorityItems
-	lock        sync.Mutex
-	disposeLock sync.Mutex
-	disposed    bool
+// removeAt 删除并返回index处的项
+func (pq *PriorityQueueOf[T]) removeAt(index int) T {
+	last := len(pq.items) - 1
+	if index != last {
+		pq.swap(index, last)
+	}
+
+	item, h := pq.items[last], pq.handles[last]
+	var zero T
+	pq.items[last], pq.items = zero, pq.items[:last]
+	pq.handles[last], pq.handles = nil, pq.handles[:last]
+	if pq.stable {
+		pq.seqs = pq.seqs[:last]
+	}
+	if h != nil {
+		h.index = -1
+	}
+
+	if index != last {
+		pq.fix(index)
+	}
+	if pq.capacity > 0 {
+		pq.space.broadcast()
+	}
+	return item
+}
+
+func (pq *PriorityQueueOf[T]) fix(index int) {
+	if !pq.down(index) {
+		pq.up(index)
+	}
 }
 
 // Push 将item添加到优先队列中
-func (pq *PriorityQueue) Push(item Item) error {
+func (pq *PriorityQueueOf[T]) Push(item T) error {
+	return pq.PushWait(context.Background(), item)
+}
+
+// PushWait 将item添加到优先队列中。队列已满且策略为BlockWhenFull时，
+// 阻塞直到队列有空间或者ctx结束
+func (pq *PriorityQueueOf[T]) PushWait(ctx context.Context, item T) error {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	_, _, err := pq.insert(ctx, item, nil)
+	return err
+}
+
+// PushEvict 将item添加到优先队列中，并返回因为队列已满而被驱逐的项。
+// 如果item本身的优先级最低，被驱逐的就是item
+func (pq *PriorityQueueOf[T]) PushEvict(item T) (T, bool, error) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	return pq.insert(context.Background(), item, nil)
+}
+
+// insert 按照容量策略将item添加到队列中，调用时必须持有lock，阻塞时会暂时释放lock
+func (pq *PriorityQueueOf[T]) insert(ctx context.Context, item T, h *Handle) (evicted T, ok bool, err error) {
+	for {
+		if pq.disposed {
+			return evicted, false, ErrDisposed
+		}
+		if pq.capacity <= 0 || len(pq.items) < pq.capacity {
+			break
+		}
+
+		switch pq.full {
+		case EvictWhenFull:
+			lowest := pq.lowest()
+			if !pq.less(item, pq.items[lowest]) {
+				if h != nil {
+					h.index = -1
+				}
+				return item, true, nil
+			}
+			evicted, ok = pq.removeAt(lowest), true
+
+		case BlockWhenFull:
+			space := pq.space.wait()
+			pq.lock.Unlock()
+			select {
+			case <-space:
+			case <-ctx.Done():
+			}
+			pq.lock.Lock()
+			if err := ctx.Err(); err != nil {
+				return evicted, false, err
+			}
+
+		default:
+			return evicted, false, ErrFull
+		}
+	}
+
+	pq.push(item, h)
+	pq.changed.broadcast()
+	return evicted, ok, nil
+}
+
+// lowest 返回优先级最低的项的位置，它一定是堆的叶子节点
+func (pq *PriorityQueueOf[T]) lowest() int {
+	lowest := 0
+	if len(pq.items) > 1 {
+		lowest = (len(pq.items)-2)/pq.arity + 1
+	}
+	for i := lowest + 1; i < len(pq.items); i++ {
+		if pq.before(lowest, i) {
+			lowest = i
+		}
+	}
+
+	return lowest
+}
+
+// PushMany 将items全部添加到优先队列中。当加入的项不少于队列中已有的项时，
+// 使用O(n)的建堆算法代替逐个插入。PushMany从不阻塞：超出容量时，
+// 策略为EvictWhenFull则驱逐优先级最低的项，否则返回ErrFull且不添加任何项
+func (pq *PriorityQueueOf[T]) PushMany(items ...T) error {
 	pq.lock.Lock()
 	defer pq.lock.Unlock()
 
 	if pq.disposed {
 		return ErrDisposed
 	}
+	if len(items) == 0 {
+		return nil
+	}
+	if pq.capacity > 0 && len(pq.items)+len(items) > pq.capacity && pq.full != EvictWhenFull {
+		return ErrFull
+	}
+
+	if len(items) < len(pq.items) {
+		for _, item := range items {
+			pq.push(item, nil)
+		}
+	} else {
+		for _, item := range items {
+			pq.items = append(pq.items, item)
+			pq.handles = append(pq.handles, nil)
+			if pq.stable {
+				pq.seqs = append(pq.seqs, pq.nextSeq())
+			}
+		}
+		pq.heapify()
+	}
+	for pq.capacity > 0 && len(pq.items) > pq.capacity {
+		pq.removeAt(pq.lowest())
+	}
 
-	pq.items.push(item)
+	pq.changed.broadcast()
 	return nil
 }
 
-// Pop 弹出优先队列中的队首项
-func (pq *PriorityQueue) Pop() (Item, error) {
+// heapify 在O(n)时间内重新建立堆的性质
+func (pq *PriorityQueueOf[T]) heapify() {
+	for i := (len(pq.items) - 2) / pq.arity; i >= 0; i-- {
+		pq.down(i)
+	}
+}
+
+// PushHandle 将item添加到优先队列中，并返回指向该项的Handle。
+// 如果item因为队列已满而被驱逐，返回的Handle不在队列中
+func (pq *PriorityQueueOf[T]) PushHandle(item T) (*Handle, error) {
 	pq.lock.Lock()
 	defer pq.lock.Unlock()
 
+	h := &Handle{}
+	if _, _, err := pq.insert(context.Background(), item, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Remove 删除h指向的项并返回它
+func (pq *PriorityQueueOf[T]) Remove(h *Handle) (T, error) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	var zero T
 	if pq.disposed {
-		return nil, ErrDisposed
+		return zero, ErrDisposed
+	}
+	if !pq.owns(h) {
+		return zero, ErrInvalidHandle
+	}
+
+	item := pq.removeAt(h.index)
+	pq.changed.broadcast()
+	return item, nil
+}
+
+// Fix 在h指向的项的优先级发生变化后，重新调整它在队列中的位置
+func (pq *PriorityQueueOf[T]) Fix(h *Handle) error {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	if pq.disposed {
+		return ErrDisposed
+	}
+	if !pq.owns(h) {
+		return ErrInvalidHandle
+	}
+
+	pq.fix(h.index)
+	pq.changed.broadcast()
+	return nil
+}
+
+// Update 将h指向的项替换为item，并调整它在队列中的位置
+func (pq *PriorityQueueOf[T]) Update(h *Handle, item T) error {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	if pq.disposed {
+		return ErrDisposed
+	}
+	if !pq.owns(h) {
+		return ErrInvalidHandle
+	}
+
+	pq.items[h.index] = item
+	pq.fix(h.index)
+	pq.changed.broadcast()
+	return nil
+}
+
+// owns 表明h是否指向当前队列中的项
+func (pq *PriorityQueueOf[T]) owns(h *Handle) bool {
+	return h != nil && h.index >= 0 && h.index < len(pq.handles) && pq.handles[h.index] == h
+}
+
+// Pop 弹出优先队列中的队首项，队列为空时返回T的零值
+func (pq *PriorityQueueOf[T]) Pop() (T, error) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	var zero T
+	if pq.disposed {
+		return zero, ErrDisposed
 	}
 
 	if len(pq.items) == 0 {
-		return nil, nil
+		return zero, nil
 	}
 
-	item := pq.items.pop()
+	item := pq.removeAt(0)
 	return item, nil
 }
 
-// Peek 返回优先队列的队首项，但是不会删除它
-func (pq *PriorityQueue) Peek() Item {
+// PopN 按顺序弹出优先队列中最多n个项
+func (pq *PriorityQueueOf[T]) PopN(n int) ([]T, error) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	if pq.disposed {
+		return nil, ErrDisposed
+	}
+
+	if n > len(pq.items) {
+		n = len(pq.items)
+	}
+	items := make([]T, 0, n)
+	for i := 0; i < n; i++ {
+		items = append(items, pq.removeAt(0))
+	}
+
+	return items, nil
+}
+
+// PopWhile 按顺序弹出队首项，直到队列为空或者队首项不满足pred
+func (pq *PriorityQueueOf[T]) PopWhile(pred func(item T) bool) ([]T, error) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	if pq.disposed {
+		return nil, ErrDisposed
+	}
+
+	var items []T
+	for len(pq.items) > 0 && pred(pq.items[0]) {
+		items = append(items, pq.removeAt(0))
+	}
+
+	return items, nil
+}
+
+// Drain 按顺序弹出优先队列中剩余的所有项。与Dispose不同，队列在Drain之后仍然可用
+func (pq *PriorityQueueOf[T]) Drain() ([]T, error) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	if pq.disposed {
+		return nil, ErrDisposed
+	}
+
+	items := make([]T, 0, len(pq.items))
+	for len(pq.items) > 0 {
+		items = append(items, pq.removeAt(0))
+	}
+
+	return items, nil
+}
+
+// lockPair 按照地址顺序锁定两把锁，避免两个方向同时合并时发生死锁
+func lockPair(a, b *sync.Mutex) func() {
+	first, second := a, b
+	if uintptr(unsafe.Pointer(b)) < uintptr(unsafe.Pointer(a)) {
+		first, second = b, a
+	}
+
+	first.Lock()
+	second.Lock()
+	return func() {
+		second.Unlock()
+		first.Unlock()
+	}
+}
+
+// Merge 将other中的所有项移入当前队列，合并后other为空但仍然可用。
+// 指向other中的项的Handle在合并后指向当前队列中的相同项。项的顺序由当前队列的less决定，
+// 稳定模式下，other中的项排在当前队列中优先级相同的项之后，并保持它们之间原有的顺序。
+// 合并后超出容量时，策略为EvictWhenFull则驱逐优先级最低的项，否则返回ErrFull且不移动任何项
+func (pq *PriorityQueueOf[T]) Merge(other *PriorityQueueOf[T]) error {
+	if pq == other {
+		return nil
+	}
+
+	unlock := lockPair(&pq.lock, &other.lock)
+	defer unlock()
+
+	if pq.disposed || other.disposed {
+		return ErrDisposed
+	}
+	if len(other.items) == 0 {
+		return nil
+	}
+	if pq.capacity > 0 && len(pq.items)+len(other.items) > pq.capacity && pq.full != EvictWhenFull {
+		return ErrFull
+	}
+
+	small := len(other.items) < len(pq.items)
+	base := pq.seq
+	for i, item := range other.items {
+		h := other.handles[i]
+		pq.items = append(pq.items, item)
+		pq.handles = append(pq.handles, h)
+		if pq.stable {
+			// 保持other中的项之间原有的先后顺序
+			seq := base + uint64(i) + 1
+			if other.stable {
+				seq = base + other.seqs[i]
+			}
+			pq.seqs = append(pq.seqs, seq)
+		}
+		if h != nil {
+			h.index = len(pq.items) - 1
+		}
+		if small {
+			pq.up(len(pq.items) - 1)
+		}
+	}
+	if pq.stable {
+		pq.seq = base + uint64(len(other.items))
+		if other.stable {
+			pq.seq = base + other.seq
+		}
+	}
+	if !small {
+		pq.heapify()
+	}
+	for pq.capacity > 0 && len(pq.items) > pq.capacity {
+		pq.removeAt(pq.lowest())
+	}
+
+	// 清空other的底层数组，以免移走的项在弹出后仍然被other引用
+	clear(other.items)
+	clear(other.handles)
+	other.items = other.items[:0]
+	other.handles = other.handles[:0]
+	if other.stable {
+		other.seqs = other.seqs[:0]
+	}
+	other.space.broadcast()
+	pq.changed.broadcast()
+	return nil
+}
+
+// Split 将满足pred的项从当前队列移入一个新的队列并返回它，新队列使用与当前队列相同的选项。
+// 指向被移动的项的Handle在拆分后指向新队列中的相同项
+func (pq *PriorityQueueOf[T]) Split(pred func(item T) bool) (*PriorityQueueOf[T], error) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	if pq.disposed {
+		return nil, ErrDisposed
+	}
+
+	moved := &PriorityQueueOf[T]{
+		less:     pq.less,
+		arity:    pq.arity,
+		stable:   pq.stable,
+		seq:      pq.seq,
+		capacity: pq.capacity,
+		full:     pq.full,
+	}
+
+	n := 0
+	for i, item := range pq.items {
+		dst, index := pq, n
+		if pred(item) {
+			dst, index = moved, len(moved.items)
+			moved.items = append(moved.items, item)
+			moved.handles = append(moved.handles, nil)
+			if pq.stable {
+				moved.seqs = append(moved.seqs, 0)
+			}
+		} else {
+			n++
+		}
+
+		dst.items[index] = item
+		dst.handles[index] = pq.handles[i]
+		if pq.stable {
+			dst.seqs[index] = pq.seqs[i]
+		}
+		if h := pq.handles[i]; h != nil {
+			h.index = index
+		}
+	}
+	if len(moved.items) == 0 {
+		return moved, nil
+	}
+
+	var zero T
+	for i := n; i < len(pq.items); i++ {
+		pq.items[i] = zero
+		pq.handles[i] = nil
+	}
+	pq.items = pq.items[:n]
+	pq.handles = pq.handles[:n]
+	if pq.stable {
+		pq.seqs = pq.seqs[:n]
+	}
+
+	pq.heapify()
+	moved.heapify()
+	if pq.capacity > 0 {
+		pq.space.broadcast()
+	}
+	return moved, nil
+}
+
+// clone 返回当前队列的一个不加锁的副本，调用时必须持有lock
+func (pq *PriorityQueueOf[T]) clone() *PriorityQueueOf[T] {
+	c := &PriorityQueueOf[T]{
+		items:   append(priorityItems[T](nil), pq.items...),
+		handles: make([]*Handle, len(pq.items)),
+		less:    pq.less,
+		arity:   pq.arity,
+		stable:  pq.stable,
+	}
+	if pq.stable {
+		c.seqs = append([]uint64(nil), pq.seqs...)
+	}
+
+	return c
+}
+
+// snapshot 返回当前队列的副本，队列已经释放时返回空队列
+func (pq *PriorityQueueOf[T]) snapshot() *PriorityQueueOf[T] {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	return pq.clone()
+}
+
+// Snapshot 按优先级顺序返回队列中所有项的副本，不会修改队列
+func (pq *PriorityQueueOf[T]) Snapshot() []T {
+	c := pq.snapshot()
+	items := make([]T, 0, len(c.items))
+	for len(c.items) > 0 {
+		items = append(items, c.removeAt(0))
+	}
+
+	return items
+}
+
+// All 返回一个按优先级顺序遍历队列中所有项的迭代器。迭代器遍历的是调用All时队列的副本，
+// 不会修改队列，每次迭代的开销为O(log n)
+func (pq *PriorityQueueOf[T]) All() iter.Seq[T] {
+	return pq.Filter(func(T) bool { return true })
+}
+
+// Filter 返回一个按优先级顺序遍历队列中所有满足pred的项的迭代器
+func (pq *PriorityQueueOf[T]) Filter(pred func(item T) bool) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		c := pq.snapshot()
+		for len(c.items) > 0 {
+			item := c.removeAt(0)
+			if pred(item) && !yield(item) {
+				return
+			}
+		}
+	}
+}
+
+// PopWait 弹出优先队列中的队首项，队列为空时阻塞直到有新的项加入或者ctx结束
+func (pq *PriorityQueueOf[T]) PopWait(ctx context.Context) (T, error) {
+	for {
+		pq.lock.Lock()
+		if pq.disposed {
+			pq.lock.Unlock()
+			var zero T
+			return zero, ErrDisposed
+		}
+
+		if len(pq.items) > 0 {
+			item := pq.removeAt(0)
+			pq.lock.Unlock()
+			return item, nil
+		}
+
+		changed := pq.changed.wait()
+		pq.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// Peek 返回优先队列的队首项，但是不会删除它。队列为空时返回T的零值
+func (pq *PriorityQueueOf[T]) Peek() T {
 	pq.lock.Lock()
 	defer pq.lock.Unlock()
 
@@ -105,11 +686,12 @@ func (pq *PriorityQueue) Peek() Item {
 		return pq.items[0]
 	}
 
-	return nil
+	var zero T
+	return zero
 }
 
 // Empty 表明队列中是否包含任何项
-func (pq *PriorityQueue) Empty() bool {
+func (pq *PriorityQueueOf[T]) Empty() bool {
 	pq.lock.Lock()
 	defer pq.lock.Unlock()
 
@@ -117,7 +699,7 @@ func (pq *PriorityQueue) Empty() bool {
 }
 
 // Len 返回优先队列的长度
-func (pq *PriorityQueue) Len() int {
+func (pq *PriorityQueueOf[T]) Len() int {
 	pq.lock.Lock()
 	defer pq.lock.Unlock()
 
@@ -125,28 +707,116 @@ func (pq *PriorityQueue) Len() int {
 }
 
 // Disposed 表明优先队列是否已经释放
-func (pq *PriorityQueue) Disposed() bool {
-	pq.disposeLock.Lock()
-	defer pq.disposeLock.Unlock()
+func (pq *PriorityQueueOf[T]) Disposed() bool {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
 
 	return pq.disposed
 }
 
 // Dispose 释放当前队列
-func (pq *PriorityQueue) Dispose() {
+func (pq *PriorityQueueOf[T]) Dispose() {
 	pq.lock.Lock()
 	defer pq.lock.Unlock()
 
-	pq.disposeLock.Lock()
-	defer pq.disposeLock.Unlock()
-
 	pq.disposed = true
+	for _, h := range pq.handles {
+		if h != nil {
+			h.index = -1
+		}
+	}
 	pq.items = nil
+	pq.handles = nil
+	pq.seqs = nil
+	pq.changed.broadcast()
+	pq.space.broadcast()
 }
 
-// NewPriorityQueue 创建一个新的优先队列
-func NewPriorityQueue(hint int) *PriorityQueue {
-	return &PriorityQueue{
-		items: make(priorityItems, 0, hint),
+// Option 用来配置优先队列
+type Option func(*options)
+
+type options struct {
+	arity    int
+	stable   bool
+	capacity int
+	full     FullPolicy
+
+	// 以下选项只对DiskQueue有效
+	memoryLimit int
+	cacheSize   int
+	sync        bool
+}
+
+// FullPolicy 决定向已满的队列添加项时的行为
+type FullPolicy int
+
+const (
+	// RejectWhenFull 拒绝添加并返回ErrFull
+	RejectWhenFull FullPolicy = iota
+	// BlockWhenFull 阻塞直到队列有空间
+	BlockWhenFull
+	// EvictWhenFull 驱逐优先级最低的项
+	EvictWhenFull
+)
+
+// WithCapacity 将队列的容量限制为capacity，队列已满时的行为由policy决定。
+// 容量小于等于0表示不限制。TimingWheel不支持容量限制，会忽略该选项
+func WithCapacity(capacity int, policy FullPolicy) Option {
+	return func(o *options) {
+		o.capacity = capacity
+		o.full = policy
 	}
 }
+
+func newOptions(opts []Option) options {
+	o := options{arity: 2}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithArity 使优先队列使用d叉堆，默认为二叉堆。较大的d使堆更浅、对缓存更友好，
+// 插入更快，但每次下沉需要比较更多的子节点
+func WithArity(d int) Option {
+	return func(o *options) {
+		if d >= 2 {
+			o.arity = d
+		}
+	}
+}
+
+// Stable 使优先级相同的项按照加入队列的顺序(FIFO)弹出
+func Stable() Option {
+	return func(o *options) {
+		o.stable = true
+	}
+}
+
+// NewPriorityQueueOf 创建一个新的优先队列，less报告a是否应该排在b之前
+func NewPriorityQueueOf[T any](hint int, less LessFunc[T], opts ...Option) *PriorityQueueOf[T] {
+	o := newOptions(opts)
+	pq := &PriorityQueueOf[T]{
+		items:    make(priorityItems[T], 0, hint),
+		handles:  make([]*Handle, 0, hint),
+		less:     less,
+		arity:    o.arity,
+		stable:   o.stable,
+		capacity: o.capacity,
+		full:     o.full,
+	}
+	if o.stable {
+		pq.seqs = make([]uint64, 0, hint)
+	}
+
+	return pq
+}
+
+func itemLess(a, b Item) bool {
+	return a.Compare(b) < 0
+}
+
+// NewPriorityQueue 创建一个新的优先队列
+func NewPriorityQueue(hint int, opts ...Option) *PriorityQueue {
+	return NewPriorityQueueOf[Item](hint, itemLess, opts...)
+}
@@ -1,8 +1,10 @@
 package queue
 
 import (
+	"context"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/gotoxu/assert"
 )
@@ -84,3 +86,386 @@ func BenchmarkPriority(b *testing.B) {
 
 	wg.Wait()
 }
+
+func TestPriorityQueueOf(t *testing.T) {
+	q := NewPriorityQueueOf[string](1, func(a, b string) bool { return len(a) < len(b) })
+	q.Push("ccc")
+	q.Push("a")
+	q.Push("bb")
+	assert.DeepEqual(t, q.Peek(), "a")
+	assert.DeepEqual(t, q.Len(), 3)
+
+	for _, want := range []string{"a", "bb", "ccc"} {
+		result, err := q.Pop()
+		assert.Nil(t, err)
+		assert.DeepEqual(t, result, want)
+	}
+
+	result, err := q.Pop()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, result, "")
+}
+
+func TestPriorityDisposed(t *testing.T) {
+	q := NewPriorityQueueOf[int](1, func(a, b int) bool { return a < b })
+	q.Push(1)
+	q.Dispose()
+	assert.True(t, q.Disposed())
+
+	assert.DeepEqual(t, q.Push(2), ErrDisposed)
+	_, err := q.Pop()
+	assert.DeepEqual(t, err, ErrDisposed)
+}
+
+func TestPriorityRemoveHandle(t *testing.T) {
+	q := NewPriorityQueue(1)
+	handles := make(map[int]*Handle)
+	for _, i := range []int{5, 3, 8, 1, 9, 2} {
+		h, err := q.PushHandle(mockItem(i))
+		assert.Nil(t, err)
+		handles[i] = h
+	}
+
+	item, err := q.Remove(handles[3])
+	assert.Nil(t, err)
+	assert.DeepEqual(t, item, mockItem(3))
+	assert.False(t, handles[3].Queued())
+
+	_, err = q.Remove(handles[3])
+	assert.DeepEqual(t, err, ErrInvalidHandle)
+
+	item, _ = q.Remove(handles[1])
+	assert.DeepEqual(t, item, mockItem(1))
+
+	for _, want := range []int{2, 5, 8, 9} {
+		result, _ := q.Pop()
+		assert.DeepEqual(t, result, mockItem(want))
+	}
+	assert.False(t, handles[9].Queued())
+}
+
+func TestPriorityUpdateHandle(t *testing.T) {
+	q := NewPriorityQueue(1)
+	h, _ := q.PushHandle(mockItem(5))
+	q.Push(mockItem(3))
+	q.Push(mockItem(7))
+
+	assert.Nil(t, q.Update(h, mockItem(1)))
+	assert.DeepEqual(t, q.Peek(), mockItem(1))
+
+	assert.Nil(t, q.Update(h, mockItem(10)))
+	for _, want := range []int{3, 7, 10} {
+		result, _ := q.Pop()
+		assert.DeepEqual(t, result, mockItem(want))
+	}
+}
+
+func TestPriorityFixHandle(t *testing.T) {
+	type task struct{ due int }
+	q := NewPriorityQueueOf[*task](1, func(a, b *task) bool { return a.due < b.due })
+	a, b := &task{due: 1}, &task{due: 2}
+	ha, _ := q.PushHandle(a)
+	q.PushHandle(b)
+
+	a.due = 3
+	assert.Nil(t, q.Fix(ha))
+	assert.DeepEqual(t, q.Peek(), b)
+
+	q.Dispose()
+	assert.False(t, ha.Queued())
+	assert.DeepEqual(t, q.Fix(ha), ErrDisposed)
+}
+
+func BenchmarkPriorityRemoveHandle(b *testing.B) {
+	q := NewPriorityQueue(b.N)
+	handles := make([]*Handle, b.N)
+	for i := 0; i < b.N; i++ {
+		handles[i], _ = q.PushHandle(mockItem(i))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q.Remove(handles[i])
+	}
+}
+
+type mockTask struct {
+	priority int
+	name     string
+}
+
+func TestPriorityStable(t *testing.T) {
+	less := func(a, b mockTask) bool { return a.priority < b.priority }
+	q := NewPriorityQueueOf[mockTask](1, less, Stable())
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for i, name := range names {
+		q.Push(mockTask{priority: i % 2, name: name})
+	}
+
+	var got []string
+	for !q.Empty() {
+		task, _ := q.Pop()
+		got = append(got, task.name)
+	}
+	assert.DeepEqual(t, got, []string{"a", "c", "e", "g", "b", "d", "f", "h"})
+}
+
+func TestPriorityStableRemove(t *testing.T) {
+	q := NewPriorityQueue(1, Stable())
+	handles := make([]*Handle, 6)
+	for i := range handles {
+		handles[i], _ = q.PushHandle(mockItem(0))
+	}
+	q.Remove(handles[0])
+	q.Remove(handles[3])
+	assert.DeepEqual(t, q.Len(), 4)
+
+	for _, i := range []int{1, 2, 4, 5} {
+		assert.True(t, handles[i].Queued())
+		q.Pop()
+		assert.False(t, handles[i].Queued())
+	}
+}
+
+func TestPriorityPushMany(t *testing.T) {
+	q := NewPriorityQueue(1)
+	q.Push(mockItem(5))
+	assert.Nil(t, q.PushMany(mockItem(9), mockItem(1), mockItem(7), mockItem(3)))
+	assert.Nil(t, q.PushMany(mockItem(4)))
+	assert.DeepEqual(t, q.Len(), 6)
+
+	items, err := q.Drain()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, items, []Item{mockItem(1), mockItem(3), mockItem(4), mockItem(5), mockItem(7), mockItem(9)})
+	assert.True(t, q.Empty())
+	assert.False(t, q.Disposed())
+}
+
+func TestPriorityPushManyStable(t *testing.T) {
+	less := func(a, b mockTask) bool { return a.priority < b.priority }
+	q := NewPriorityQueueOf[mockTask](1, less, Stable())
+	q.PushMany(mockTask{1, "a"}, mockTask{0, "b"}, mockTask{1, "c"}, mockTask{0, "d"})
+
+	items, _ := q.Drain()
+	var got []string
+	for _, item := range items {
+		got = append(got, item.name)
+	}
+	assert.DeepEqual(t, got, []string{"b", "d", "a", "c"})
+}
+
+func TestPriorityPopN(t *testing.T) {
+	q := NewPriorityQueue(1)
+	q.PushMany(mockItem(3), mockItem(1), mockItem(2))
+
+	items, err := q.PopN(2)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, items, []Item{mockItem(1), mockItem(2)})
+
+	items, _ = q.PopN(5)
+	assert.DeepEqual(t, items, []Item{mockItem(3)})
+}
+
+func TestPriorityPopWhile(t *testing.T) {
+	q := NewPriorityQueue(1)
+	q.PushMany(mockItem(4), mockItem(1), mockItem(3), mockItem(2))
+
+	items, err := q.PopWhile(func(item Item) bool { return item.(mockItem) < 3 })
+	assert.Nil(t, err)
+	assert.DeepEqual(t, items, []Item{mockItem(1), mockItem(2)})
+	assert.DeepEqual(t, q.Len(), 2)
+
+	q.Dispose()
+	_, err = q.Drain()
+	assert.DeepEqual(t, err, ErrDisposed)
+}
+
+func BenchmarkPriorityPushMany(b *testing.B) {
+	items := make([]Item, b.N)
+	for i := range items {
+		items[i] = mockItem(b.N - i)
+	}
+
+	q := NewPriorityQueue(b.N)
+	b.ResetTimer()
+	q.PushMany(items...)
+}
+
+func BenchmarkPriorityPushEach(b *testing.B) {
+	items := make([]Item, b.N)
+	for i := range items {
+		items[i] = mockItem(b.N - i)
+	}
+
+	q := NewPriorityQueue(b.N)
+	b.ResetTimer()
+	for _, item := range items {
+		q.Push(item)
+	}
+}
+
+func TestPrioritySnapshot(t *testing.T) {
+	q := NewPriorityQueue(1)
+	q.PushMany(mockItem(3), mockItem(1), mockItem(2))
+
+	assert.DeepEqual(t, q.Snapshot(), []Item{mockItem(1), mockItem(2), mockItem(3)})
+	assert.DeepEqual(t, q.Len(), 3)
+	assert.DeepEqual(t, q.Peek(), mockItem(1))
+}
+
+func TestPriorityAll(t *testing.T) {
+	q := NewPriorityQueue(1)
+	q.PushMany(mockItem(4), mockItem(1), mockItem(3), mockItem(2))
+
+	var got []Item
+	for item := range q.All() {
+		got = append(got, item)
+		if len(got) == 3 {
+			break
+		}
+	}
+	assert.DeepEqual(t, got, []Item{mockItem(1), mockItem(2), mockItem(3)})
+	assert.DeepEqual(t, q.Len(), 4)
+
+	got = nil
+	for item := range q.Filter(func(item Item) bool { return item.(mockItem)%2 == 0 }) {
+		got = append(got, item)
+	}
+	assert.DeepEqual(t, got, []Item{mockItem(2), mockItem(4)})
+}
+
+func TestPriorityCapacityReject(t *testing.T) {
+	q := NewPriorityQueue(1, WithCapacity(2, RejectWhenFull))
+	assert.Nil(t, q.Push(mockItem(1)))
+	assert.Nil(t, q.Push(mockItem(2)))
+	assert.DeepEqual(t, q.Push(mockItem(3)), ErrFull)
+	assert.DeepEqual(t, q.PushMany(mockItem(4)), ErrFull)
+	assert.DeepEqual(t, q.Len(), 2)
+
+	q.Pop()
+	assert.Nil(t, q.Push(mockItem(3)))
+}
+
+func TestPriorityCapacityEvict(t *testing.T) {
+	q := NewPriorityQueue(1, WithCapacity(3, EvictWhenFull))
+	q.PushMany(mockItem(5), mockItem(1), mockItem(3))
+
+	evicted, ok, err := q.PushEvict(mockItem(2))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.DeepEqual(t, evicted, mockItem(5))
+
+	// 新加入的项优先级最低时，被驱逐的是它自己
+	evicted, ok, _ = q.PushEvict(mockItem(9))
+	assert.True(t, ok)
+	assert.DeepEqual(t, evicted, mockItem(9))
+
+	h, err := q.PushHandle(mockItem(8))
+	assert.Nil(t, err)
+	assert.False(t, h.Queued())
+
+	q.PushMany(mockItem(0), mockItem(7))
+	assert.DeepEqual(t, q.Snapshot(), []Item{mockItem(0), mockItem(1), mockItem(2)})
+}
+
+func TestPriorityCapacityBlock(t *testing.T) {
+	q := NewPriorityQueue(1, WithCapacity(1, BlockWhenFull))
+	q.Push(mockItem(1))
+
+	done := make(chan error)
+	go func() {
+		done <- q.Push(mockItem(2))
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("push should block while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	q.Pop()
+	assert.Nil(t, <-done)
+	assert.DeepEqual(t, q.Peek(), mockItem(2))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.DeepEqual(t, q.PushWait(ctx, mockItem(3)), context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Dispose()
+	}()
+	assert.DeepEqual(t, q.Push(mockItem(3)), ErrDisposed)
+}
+
+func TestPriorityMerge(t *testing.T) {
+	a := NewPriorityQueue(1)
+	b := NewPriorityQueue(1)
+	a.PushMany(mockItem(1), mockItem(4), mockItem(7))
+	b.PushMany(mockItem(2), mockItem(5))
+	h, _ := b.PushHandle(mockItem(6))
+
+	assert.Nil(t, a.Merge(b))
+	assert.True(t, b.Empty())
+	assert.False(t, b.Disposed())
+	assert.Len(t, a.items, 6)
+	// b不再引用移走的项
+	for _, item := range b.items[:cap(b.items)] {
+		assert.Nil(t, item)
+	}
+
+	// Handle跟随项移动到合并后的队列
+	assert.Nil(t, a.Update(h, mockItem(0)))
+	assert.DeepEqual(t, a.Snapshot(), []Item{mockItem(0), mockItem(1), mockItem(2), mockItem(4), mockItem(5), mockItem(7)})
+	_, err := b.Remove(h)
+	assert.DeepEqual(t, err, ErrInvalidHandle)
+
+	c := NewPriorityQueue(1, WithCapacity(2, RejectWhenFull))
+	c.Push(mockItem(3))
+	assert.DeepEqual(t, c.Merge(a), ErrFull)
+	assert.Len(t, a.items, 6)
+}
+
+func TestPriorityMergeStable(t *testing.T) {
+	less := func(a, b *mockTask) bool { return a.priority < b.priority }
+	a := NewPriorityQueueOf[*mockTask](1, less, Stable())
+	b := NewPriorityQueueOf[*mockTask](1, less, Stable())
+	a.Push(&mockTask{priority: 1, name: "a1"})
+	b.Push(&mockTask{priority: 1, name: "b1"})
+	b.Push(&mockTask{priority: 1, name: "b2"})
+	a.Push(&mockTask{priority: 1, name: "a2"})
+	assert.Nil(t, a.Merge(b))
+	a.Push(&mockTask{priority: 1, name: "a3"})
+
+	var names []string
+	for _, task := range a.Snapshot() {
+		names = append(names, task.name)
+	}
+	assert.DeepEqual(t, names, []string{"a1", "a2", "b1", "b2", "a3"})
+}
+
+func TestPrioritySplit(t *testing.T) {
+	q := NewPriorityQueue(1)
+	handles := make([]*Handle, 10)
+	for i := range handles {
+		handles[i], _ = q.PushHandle(mockItem(i))
+	}
+
+	odd, err := q.Split(func(item Item) bool { return item.(mockItem)%2 == 1 })
+	assert.Nil(t, err)
+	assert.DeepEqual(t, q.Snapshot(), []Item{mockItem(0), mockItem(2), mockItem(4), mockItem(6), mockItem(8)})
+	assert.DeepEqual(t, odd.Snapshot(), []Item{mockItem(1), mockItem(3), mockItem(5), mockItem(7), mockItem(9)})
+
+	item, err := odd.Remove(handles[5])
+	assert.Nil(t, err)
+	assert.DeepEqual(t, item, mockItem(5))
+	_, err = q.Remove(handles[7])
+	assert.DeepEqual(t, err, ErrInvalidHandle)
+	assert.Nil(t, q.Update(handles[8], mockItem(-1)))
+	assert.DeepEqual(t, q.Peek(), mockItem(-1))
+
+	none, err := q.Split(func(Item) bool { return false })
+	assert.Nil(t, err)
+	assert.True(t, none.Empty())
+	assert.Nil(t, none.Push(mockItem(1)))
+}
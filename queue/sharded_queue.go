@@ -0,0 +1,225 @@
+package queue
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync/atomic"
+)
+
+// ShardedPriorityQueueOf 是一个分片的并发优先队列。每个分片是一个独立加锁的
+// PriorityQueueOf，Push只锁定随机选择的一个分片，因此多个生产者之间几乎没有竞争。
+// Pop返回全局优先级最高的项，PopRelaxed则以近似的顺序换取更高的吞吐量。
+// 稳定模式下各个分片共用一个序号，Pop和Peek在所有分片之间保持优先级相同的项加入队列的顺序
+type ShardedPriorityQueueOf[T any] struct {
+	shards []*PriorityQueueOf[T]
+	less   LessFunc[T]
+	stable bool
+	seq    atomic.Uint64
+}
+
+// ShardedPriorityQueue 是一个分片的优先队列，其中的项通过Item.Compare排序
+type ShardedPriorityQueue = ShardedPriorityQueueOf[Item]
+
+// NewShardedPriorityQueueOf 创建一个新的分片优先队列。shards小于等于0时使用GOMAXPROCS个分片，
+// hint是每个分片的初始容量，opts作用于每个分片
+func NewShardedPriorityQueueOf[T any](shards, hint int, less LessFunc[T], opts ...Option) *ShardedPriorityQueueOf[T] {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+
+	sq := &ShardedPriorityQueueOf[T]{
+		shards: make([]*PriorityQueueOf[T], shards),
+		less:   less,
+		stable: newOptions(opts).stable,
+	}
+	for i := range sq.shards {
+		sq.shards[i] = NewPriorityQueueOf[T](hint, less, opts...)
+		sq.shards[i].shared = &sq.seq
+	}
+
+	return sq
+}
+
+// NewShardedPriorityQueue 创建一个新的分片优先队列
+func NewShardedPriorityQueue(shards, hint int, opts ...Option) *ShardedPriorityQueue {
+	return NewShardedPriorityQueueOf[Item](shards, hint, itemLess, opts...)
+}
+
+// before 报告序号为aSeq的队首项a是否应该排在序号为bSeq的队首项b之前
+func (sq *ShardedPriorityQueueOf[T]) before(a T, aSeq uint64, b T, bSeq uint64) bool {
+	if sq.less(a, b) {
+		return true
+	}
+	return sq.stable && !sq.less(b, a) && aSeq < bSeq
+}
+
+// Push 将item添加到随机选择的一个分片中
+func (sq *ShardedPriorityQueueOf[T]) Push(item T) error {
+	return sq.shards[rand.IntN(len(sq.shards))].Push(item)
+}
+
+// Pop 弹出所有分片中优先级最高的项，队列为空时返回T的零值。
+// Pop需要同时锁定所有分片，以保证弹出的是全局的队首项
+func (sq *ShardedPriorityQueueOf[T]) Pop() (T, error) {
+	for _, shard := range sq.shards {
+		shard.lock.Lock()
+	}
+	defer func() {
+		for _, shard := range sq.shards {
+			shard.lock.Unlock()
+		}
+	}()
+
+	var (
+		zero     T
+		best     = -1
+		bestHead T
+		bestSeq  uint64
+	)
+	for i, shard := range sq.shards {
+		if shard.disposed {
+			return zero, ErrDisposed
+		}
+		if len(shard.items) == 0 {
+			continue
+		}
+		head, seq := shard.head()
+		if best < 0 || sq.before(head, seq, bestHead, bestSeq) {
+			best, bestHead, bestSeq = i, head, seq
+		}
+	}
+
+	if best < 0 {
+		return zero, nil
+	}
+	return sq.shards[best].removeAt(0), nil
+}
+
+// PopRelaxed 从随机选择的两个分片中弹出优先级较高的队首项，每次只锁定一个分片。
+// 弹出的不一定是全局的队首项，但是连续调用时整体上接近优先级顺序。
+// 两个分片都为空时依次尝试其他分片，所有分片都为空时返回T的零值
+func (sq *ShardedPriorityQueueOf[T]) PopRelaxed() (T, error) {
+	n := len(sq.shards)
+	first := rand.IntN(n)
+	second := first
+	if n > 1 {
+		second = (first + 1 + rand.IntN(n-1)) % n
+	}
+
+	var zero T
+	for attempt := 0; attempt < 2; attempt++ {
+		a, b := sq.shards[first], sq.shards[second]
+		aHead, aSeq, aOK := a.peek()
+		bHead, bSeq, bOK := b.peek()
+
+		shard := a
+		switch {
+		case aOK && bOK:
+			if sq.before(bHead, bSeq, aHead, aSeq) {
+				shard = b
+			}
+		case bOK:
+			shard = b
+		case !aOK:
+			continue
+		}
+
+		item, ok, err := shard.popIfAny()
+		if err != nil || ok {
+			return item, err
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		item, ok, err := sq.shards[(first+i)%n].popIfAny()
+		if err != nil || ok {
+			return item, err
+		}
+	}
+
+	return zero, nil
+}
+
+// head 返回队首项及其序号，非稳定模式下序号为0。调用时必须持有lock且队列不为空
+func (pq *PriorityQueueOf[T]) head() (T, uint64) {
+	if pq.stable {
+		return pq.items[0], pq.seqs[0]
+	}
+	return pq.items[0], 0
+}
+
+// peek 返回队首项及其序号，队列为空时返回false
+func (pq *PriorityQueueOf[T]) peek() (T, uint64, bool) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	if len(pq.items) == 0 {
+		var zero T
+		return zero, 0, false
+	}
+	head, seq := pq.head()
+	return head, seq, true
+}
+
+// popIfAny 弹出队首项，队列为空时返回false
+func (pq *PriorityQueueOf[T]) popIfAny() (T, bool, error) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	var zero T
+	if pq.disposed {
+		return zero, false, ErrDisposed
+	}
+	if len(pq.items) == 0 {
+		return zero, false, nil
+	}
+	return pq.removeAt(0), true, nil
+}
+
+// Peek 返回所有分片中优先级最高的项，但是不会删除它
+func (sq *ShardedPriorityQueueOf[T]) Peek() T {
+	var (
+		best    T
+		bestSeq uint64
+		found   bool
+	)
+	for _, shard := range sq.shards {
+		head, seq, ok := shard.peek()
+		if ok && (!found || sq.before(head, seq, best, bestSeq)) {
+			best, bestSeq, found = head, seq, true
+		}
+	}
+
+	return best
+}
+
+// Len 返回所有分片中项的总数
+func (sq *ShardedPriorityQueueOf[T]) Len() int {
+	n := 0
+	for _, shard := range sq.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// Empty 表明队列中是否包含任何项
+func (sq *ShardedPriorityQueueOf[T]) Empty() bool {
+	for _, shard := range sq.shards {
+		if !shard.Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// Disposed 表明队列是否已经释放
+func (sq *ShardedPriorityQueueOf[T]) Disposed() bool {
+	return sq.shards[0].Disposed()
+}
+
+// Dispose 释放所有分片
+func (sq *ShardedPriorityQueueOf[T]) Dispose() {
+	for _, shard := range sq.shards {
+		shard.Dispose()
+	}
+}
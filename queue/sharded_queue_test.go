@@ -0,0 +1,182 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gotoxu/assert"
+)
+
+func TestShardedPop(t *testing.T) {
+	q := NewShardedPriorityQueue(4, 1)
+	for _, i := range []int{5, 3, 8, 1, 9, 2, 7} {
+		assert.Nil(t, q.Push(mockItem(i)))
+	}
+	assert.DeepEqual(t, q.Len(), 7)
+	assert.DeepEqual(t, q.Peek(), mockItem(1))
+
+	for _, want := range []int{1, 2, 3, 5, 7, 8, 9} {
+		item, err := q.Pop()
+		assert.Nil(t, err)
+		assert.DeepEqual(t, item, mockItem(want))
+	}
+
+	item, err := q.Pop()
+	assert.Nil(t, err)
+	assert.Nil(t, item)
+	assert.True(t, q.Empty())
+}
+
+func TestShardedPopRelaxed(t *testing.T) {
+	q := NewShardedPriorityQueue(4, 1)
+	seen := make(map[mockItem]bool)
+	for i := 0; i < 100; i++ {
+		q.Push(mockItem(i))
+	}
+
+	for i := 0; i < 100; i++ {
+		item, err := q.PopRelaxed()
+		assert.Nil(t, err)
+		assert.NotNil(t, item)
+		seen[item.(mockItem)] = true
+	}
+	assert.Len(t, seen, 100)
+
+	item, _ := q.PopRelaxed()
+	assert.Nil(t, item)
+}
+
+func TestShardedConcurrent(t *testing.T) {
+	q := NewShardedPriorityQueue(0, 1)
+	var wg sync.WaitGroup
+	for p := 0; p < 8; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				q.Push(mockItem(p*1000 + i))
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	var popped int64
+	for c := 0; c < 8; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				item, _ := q.PopRelaxed()
+				if item == nil {
+					return
+				}
+				atomic.AddInt64(&popped, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.DeepEqual(t, popped, int64(8000))
+}
+
+func TestShardedDispose(t *testing.T) {
+	q := NewShardedPriorityQueue(2, 1)
+	q.Dispose()
+	assert.True(t, q.Disposed())
+	assert.DeepEqual(t, q.Push(mockItem(1)), ErrDisposed)
+
+	_, err := q.Pop()
+	assert.DeepEqual(t, err, ErrDisposed)
+	_, err = q.PopRelaxed()
+	assert.DeepEqual(t, err, ErrDisposed)
+}
+
+func BenchmarkParallelPushPop(b *testing.B) {
+	b.Run("single", func(b *testing.B) {
+		q := NewPriorityQueue(1)
+		var n int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				i := atomic.AddInt64(&n, 1)
+				q.Push(mockItem(i))
+				q.Pop()
+			}
+		})
+	})
+
+	b.Run("sharded", func(b *testing.B) {
+		q := NewShardedPriorityQueue(0, 1)
+		var n int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				i := atomic.AddInt64(&n, 1)
+				q.Push(mockItem(i))
+				q.Pop()
+			}
+		})
+	})
+
+	b.Run("sharded-relaxed", func(b *testing.B) {
+		q := NewShardedPriorityQueue(0, 1)
+		var n int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				i := atomic.AddInt64(&n, 1)
+				q.Push(mockItem(i))
+				q.PopRelaxed()
+			}
+		})
+	})
+}
+
+func BenchmarkParallelPush(b *testing.B) {
+	b.Run("single", func(b *testing.B) {
+		q := NewPriorityQueue(b.N)
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				i++
+				q.Push(mockItem(i))
+			}
+		})
+	})
+
+	b.Run("sharded", func(b *testing.B) {
+		q := NewShardedPriorityQueue(0, 1)
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				i++
+				q.Push(mockItem(i))
+			}
+		})
+	})
+}
+
+func TestShardedStable(t *testing.T) {
+	q := NewShardedPriorityQueueOf[*mockTask](4, 1, func(a, b *mockTask) bool {
+		return a.priority < b.priority
+	}, Stable())
+	for i := 0; i < 40; i++ {
+		q.Push(&mockTask{priority: i % 2, name: fmt.Sprint(i)})
+	}
+
+	// 优先级相同的项跨越分片仍然按照加入队列的顺序弹出
+	assert.DeepEqual(t, q.Peek().name, "0")
+	var names []string
+	for i := 0; i < 40; i++ {
+		task, err := q.Pop()
+		assert.Nil(t, err)
+		names = append(names, task.name)
+	}
+	var want []string
+	for i := 0; i < 40; i += 2 {
+		want = append(want, fmt.Sprint(i))
+	}
+	for i := 1; i < 40; i += 2 {
+		want = append(want, fmt.Sprint(i))
+	}
+	assert.DeepEqual(t, names, want)
+}
@@ -0,0 +1,22 @@
+package queue
+
+// signal 是一个可以反复广播的条件变量，所有方法都必须在持有队列的锁时调用
+type signal struct {
+	c chan struct{}
+}
+
+// wait 返回一个在下次广播时关闭的channel
+func (s *signal) wait() <-chan struct{} {
+	if s.c == nil {
+		s.c = make(chan struct{})
+	}
+	return s.c
+}
+
+// broadcast 唤醒所有等待者
+func (s *signal) broadcast() {
+	if s.c != nil {
+		close(s.c)
+		s.c = nil
+	}
+}
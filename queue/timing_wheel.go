@@ -0,0 +1,367 @@
+package queue
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	wheelBits   = 6
+	wheelSize   = 1 << wheelBits
+	wheelMask   = wheelSize - 1
+	wheelLevels = 8
+)
+
+type wheelNode[T Delayed] struct {
+	item   T
+	expiry int64
+	seq    uint64
+	handle *Handle
+	// wheel 是节点所在的时间轮，用于拒绝其他时间轮的Handle
+	wheel *TimingWheel[T]
+
+	// 节点位于某个槽位的双向链表中时，level和slot记录槽位的位置；
+	// 到期后节点被移入ready堆，此时ready指向它在堆中的位置
+	level, slot int
+	prev, next  *wheelNode[T]
+	ready       *Handle
+}
+
+// TimingWheel 是一个分层时间轮，插入和删除的时间复杂度都是O(1)。
+// 时间轮的精度为tick，到期的项按照Deadline的顺序弹出
+type TimingWheel[T Delayed] struct {
+	tick    time.Duration
+	origin  time.Time
+	current int64
+
+	slots  [wheelLevels][wheelSize]*wheelNode[T]
+	counts [wheelLevels]int
+	ready  *PriorityQueueOf[*wheelNode[T]]
+	size   int
+	seq    uint64
+
+	lock     sync.Mutex
+	disposed bool
+}
+
+// NewTimingWheel 创建一个新的时间轮，tick是时间轮的精度，start是时间轮的起始时间
+func NewTimingWheel[T Delayed](tick time.Duration, start time.Time, opts ...Option) *TimingWheel[T] {
+	return NewTimingWheelFunc[T](tick, start, delayedLess[T], opts...)
+}
+
+// NewTimingWheelFunc 创建一个新的时间轮，到期项的顺序由less决定。
+// less必须首先按照Deadline排序，只能在Deadline相同时使用其他条件
+func NewTimingWheelFunc[T Delayed](tick time.Duration, start time.Time, less LessFunc[T], opts ...Option) *TimingWheel[T] {
+	if tick <= 0 {
+		tick = time.Millisecond
+	}
+
+	o := newOptions(opts)
+	return &TimingWheel[T]{
+		tick:   tick,
+		origin: start,
+		ready: NewPriorityQueueOf[*wheelNode[T]](1, func(a, b *wheelNode[T]) bool {
+			if less(a.item, b.item) {
+				return true
+			}
+			// 到期项进入ready堆的顺序与加入时间轮的顺序无关，所以稳定模式需要比较加入时的序号
+			return o.stable && !less(b.item, a.item) && a.seq < b.seq
+		}),
+	}
+}
+
+// ticks 将t换算为相对于origin的刻度
+func (tw *TimingWheel[T]) ticks(t time.Time) int64 {
+	d := t.Sub(tw.origin)
+	if d < 0 {
+		return int64(math.Floor(float64(d) / float64(tw.tick)))
+	}
+	return int64(d / tw.tick)
+}
+
+func levelUnit(level int) int64 {
+	return int64(1) << (wheelBits * uint(level))
+}
+
+// place 将节点放入对应的槽位，已经到期的节点放入ready堆
+func (tw *TimingWheel[T]) place(n *wheelNode[T]) {
+	if n.expiry <= tw.current {
+		n.ready = &Handle{}
+		tw.ready.push(n, n.ready)
+		return
+	}
+
+	delta := n.expiry - tw.current
+	level := wheelLevels - 1
+	slot := -1
+	for l := 0; l < wheelLevels; l++ {
+		if delta < levelUnit(l+1) {
+			level = l
+			slot = int((n.expiry >> (wheelBits * uint(l))) & wheelMask)
+			break
+		}
+	}
+	if slot < 0 {
+		// 超出时间轮的范围，放入最高层中最后被处理的槽位，届时重新计算位置
+		slot = int(((tw.current >> (wheelBits * uint(level))) + wheelMask) & wheelMask)
+	}
+
+	n.level, n.slot = level, slot
+	n.prev = nil
+	n.next = tw.slots[level][slot]
+	if n.next != nil {
+		n.next.prev = n
+	}
+	tw.slots[level][slot] = n
+	tw.counts[level]++
+}
+
+// unlink 将节点从它所在的槽位或者ready堆中删除
+func (tw *TimingWheel[T]) unlink(n *wheelNode[T]) {
+	if n.ready != nil {
+		tw.ready.removeAt(n.ready.index)
+		n.ready = nil
+		return
+	}
+
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		tw.slots[n.level][n.slot] = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	}
+	n.prev, n.next = nil, nil
+	tw.counts[n.level]--
+}
+
+// take 取出某个槽位中的所有节点
+func (tw *TimingWheel[T]) take(level, slot int) *wheelNode[T] {
+	head := tw.slots[level][slot]
+	tw.slots[level][slot] = nil
+	for n := head; n != nil; n = n.next {
+		tw.counts[level]--
+	}
+
+	return head
+}
+
+// next 返回大于current的最小刻度，在该刻度上有槽位需要处理
+func (tw *TimingWheel[T]) next() (int64, bool) {
+	best, found := int64(math.MaxInt64), false
+	for l := 0; l < wheelLevels; l++ {
+		if tw.counts[l] == 0 {
+			continue
+		}
+
+		unit := levelUnit(l)
+		first := (floorDiv(tw.current, unit) + 1) * unit
+		for i := int64(0); i < wheelSize; i++ {
+			t := first + i*unit
+			if t >= best {
+				break
+			}
+			if tw.slots[l][(t>>(wheelBits*uint(l)))&wheelMask] != nil {
+				best, found = t, true
+				break
+			}
+		}
+	}
+
+	return best, found
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// advance 将时间轮推进到target刻度，沿途处理所有需要降级或者到期的槽位
+func (tw *TimingWheel[T]) advance(target int64) {
+	for tw.current < target {
+		t, ok := tw.next()
+		if !ok || t > target {
+			tw.current = target
+			return
+		}
+
+		tw.current = t
+		for l := wheelLevels - 1; l > 0; l-- {
+			unit := levelUnit(l)
+			if t%unit != 0 {
+				continue
+			}
+
+			for n := tw.take(l, int((t>>(wheelBits*uint(l)))&wheelMask)); n != nil; {
+				next := n.next
+				n.prev, n.next = nil, nil
+				tw.place(n)
+				n = next
+			}
+		}
+
+		for n := tw.take(0, int(t&wheelMask)); n != nil; {
+			next := n.next
+			n.prev, n.next = nil, nil
+			n.ready = &Handle{}
+			tw.ready.push(n, n.ready)
+			n = next
+		}
+	}
+}
+
+// PushHandle 将item添加到时间轮中，并返回指向该项的Handle
+func (tw *TimingWheel[T]) PushHandle(item T) (*Handle, error) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	if tw.disposed {
+		return nil, ErrDisposed
+	}
+
+	tw.seq++
+	n := &wheelNode[T]{item: item, expiry: tw.ticks(item.Deadline()), seq: tw.seq, wheel: tw}
+	n.handle = &Handle{ref: n}
+	tw.place(n)
+	tw.size++
+	return n.handle, nil
+}
+
+// Push 将item添加到时间轮中
+func (tw *TimingWheel[T]) Push(item T) error {
+	_, err := tw.PushHandle(item)
+	return err
+}
+
+// node 返回h指向的节点，h不属于当前时间轮时返回nil
+func (tw *TimingWheel[T]) node(h *Handle) *wheelNode[T] {
+	if h == nil || h.index < 0 {
+		return nil
+	}
+
+	n, ok := h.ref.(*wheelNode[T])
+	if !ok || n.handle != h || n.wheel != tw {
+		return nil
+	}
+	return n
+}
+
+// Remove 删除h指向的项并返回它
+func (tw *TimingWheel[T]) Remove(h *Handle) (T, error) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	var zero T
+	if tw.disposed {
+		return zero, ErrDisposed
+	}
+
+	n := tw.node(h)
+	if n == nil {
+		return zero, ErrInvalidHandle
+	}
+
+	tw.unlink(n)
+	tw.size--
+	h.index = -1
+	return n.item, nil
+}
+
+// Update 将h指向的项替换为item，并按照新的Deadline调整它的位置
+func (tw *TimingWheel[T]) Update(h *Handle, item T) error {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	if tw.disposed {
+		return ErrDisposed
+	}
+
+	n := tw.node(h)
+	if n == nil {
+		return ErrInvalidHandle
+	}
+
+	tw.unlink(n)
+	n.item = item
+	n.expiry = tw.ticks(item.Deadline())
+	tw.place(n)
+	return nil
+}
+
+// PopExpired 将时间轮推进到now，并弹出一个Deadline不晚于now的项
+func (tw *TimingWheel[T]) PopExpired(now time.Time) (T, bool) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	var zero T
+	if tw.disposed {
+		return zero, false
+	}
+
+	tw.advance(tw.ticks(now))
+	if len(tw.ready.items) == 0 || tw.ready.items[0].item.Deadline().After(now) {
+		return zero, false
+	}
+
+	n := tw.ready.removeAt(0)
+	n.ready = nil
+	n.handle.index = -1
+	tw.size--
+	return n.item, true
+}
+
+// NextDeadline 返回下一次需要调用PopExpired的时间。对于仍在时间轮中的项，
+// 返回的是它们所在槽位的处理时间，可能早于它们的Deadline
+func (tw *TimingWheel[T]) NextDeadline() (time.Time, bool) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	if len(tw.ready.items) > 0 {
+		return tw.ready.items[0].item.Deadline(), true
+	}
+
+	t, ok := tw.next()
+	if !ok {
+		return time.Time{}, false
+	}
+	if t > math.MaxInt64/int64(tw.tick) {
+		return tw.origin.Add(math.MaxInt64), true
+	}
+	return tw.origin.Add(time.Duration(t) * tw.tick), true
+}
+
+// Len 返回时间轮中项的数量
+func (tw *TimingWheel[T]) Len() int {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	return tw.size
+}
+
+// Dispose 释放当前时间轮
+func (tw *TimingWheel[T]) Dispose() {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	for l := range tw.slots {
+		for s := range tw.slots[l] {
+			for n := tw.slots[l][s]; n != nil; n = n.next {
+				n.handle.index = -1
+			}
+			tw.slots[l][s] = nil
+		}
+		tw.counts[l] = 0
+	}
+	for _, n := range tw.ready.items {
+		n.handle.index = -1
+	}
+	tw.ready.items, tw.ready.handles = nil, nil
+
+	tw.size = 0
+	tw.disposed = true
+}
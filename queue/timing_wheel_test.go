@@ -0,0 +1,221 @@
+package queue
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+// drain 按照NextDeadline推进时间，弹出所有项
+func drain(q TimerQueue[mockDelayed]) []mockDelayed {
+	var result []mockDelayed
+	for {
+		next, ok := q.NextDeadline()
+		if !ok {
+			return result
+		}
+		for {
+			item, ok := q.PopExpired(next)
+			if !ok {
+				break
+			}
+			result = append(result, item)
+		}
+	}
+}
+
+func TestTimingWheelOrder(t *testing.T) {
+	start := time.Now()
+	tw := NewTimingWheel[mockDelayed](time.Millisecond, start)
+
+	var want []mockDelayed
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		// 覆盖多个层级，包括已经过期的项
+		d := time.Duration(r.Int63n(int64(48*time.Hour))) - time.Second
+		item := mockDelayed(start.Add(d))
+		want = append(want, item)
+		assert.Nil(t, tw.Push(item))
+	}
+	sort.Slice(want, func(i, j int) bool { return time.Time(want[i]).Before(time.Time(want[j])) })
+
+	got := drain(tw)
+	assert.DeepEqual(t, len(got), len(want))
+	for i := range want {
+		assert.True(t, time.Time(got[i]).Equal(time.Time(want[i])))
+	}
+	assert.DeepEqual(t, tw.Len(), 0)
+}
+
+func TestTimingWheelPopExpired(t *testing.T) {
+	start := time.Now()
+	tw := NewTimingWheel[mockDelayed](10*time.Millisecond, start)
+	tw.Push(mockDelayed(start.Add(25 * time.Millisecond)))
+
+	_, ok := tw.PopExpired(start.Add(24 * time.Millisecond))
+	assert.False(t, ok)
+
+	next, ok := tw.NextDeadline()
+	assert.True(t, ok)
+	assert.True(t, !next.After(start.Add(25*time.Millisecond)))
+
+	item, ok := tw.PopExpired(start.Add(25 * time.Millisecond))
+	assert.True(t, ok)
+	assert.DeepEqual(t, item, mockDelayed(start.Add(25*time.Millisecond)))
+
+	_, ok = tw.NextDeadline()
+	assert.False(t, ok)
+}
+
+func TestTimingWheelRemoveAndUpdate(t *testing.T) {
+	start := time.Now()
+	tw := NewTimingWheel[mockDelayed](time.Millisecond, start)
+	a, _ := tw.PushHandle(mockDelayed(start.Add(time.Hour)))
+	b, _ := tw.PushHandle(mockDelayed(start.Add(2 * time.Hour)))
+	c, _ := tw.PushHandle(mockDelayed(start.Add(-time.Second)))
+
+	item, err := tw.Remove(a)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, item, mockDelayed(start.Add(time.Hour)))
+	assert.False(t, a.Queued())
+	_, err = tw.Remove(a)
+	assert.DeepEqual(t, err, ErrInvalidHandle)
+
+	// c已经在ready堆中
+	_, err = tw.Remove(c)
+	assert.Nil(t, err)
+
+	assert.Nil(t, tw.Update(b, mockDelayed(start.Add(time.Minute))))
+	assert.DeepEqual(t, tw.Len(), 1)
+
+	got := drain(tw)
+	assert.DeepEqual(t, got, []mockDelayed{mockDelayed(start.Add(time.Minute))})
+	assert.False(t, b.Queued())
+}
+
+func TestTimingWheelForeignHandle(t *testing.T) {
+	start := time.Now()
+	a := NewTimingWheel[mockDelayed](time.Millisecond, start)
+	b := NewTimingWheel[mockDelayed](time.Millisecond, start)
+	ha, _ := a.PushHandle(mockDelayed(start.Add(time.Second)))
+	b.Push(mockDelayed(start.Add(time.Second)))
+
+	// 其他时间轮的Handle不能删除或修改当前时间轮中的项
+	_, err := b.Remove(ha)
+	assert.DeepEqual(t, err, ErrInvalidHandle)
+	assert.DeepEqual(t, b.Update(ha, mockDelayed(start)), ErrInvalidHandle)
+	assert.True(t, ha.Queued())
+
+	assert.DeepEqual(t, drain(a), []mockDelayed{mockDelayed(start.Add(time.Second))})
+	assert.DeepEqual(t, drain(b), []mockDelayed{mockDelayed(start.Add(time.Second))})
+}
+
+func TestTimingWheelDispose(t *testing.T) {
+	start := time.Now()
+	tw := NewTimingWheel[mockDelayed](time.Millisecond, start)
+	h, _ := tw.PushHandle(mockDelayed(start.Add(time.Hour)))
+	tw.Dispose()
+
+	assert.False(t, h.Queued())
+	assert.DeepEqual(t, tw.Push(mockDelayed(start)), ErrDisposed)
+}
+
+func TestDelayQueueTimerQueue(t *testing.T) {
+	start := time.Now()
+	q := NewDelayQueue[mockDelayed](1)
+	q.Push(mockDelayed(start.Add(2 * time.Second)))
+	q.Push(mockDelayed(start.Add(time.Second)))
+
+	got := drain(q)
+	assert.DeepEqual(t, got, []mockDelayed{mockDelayed(start.Add(time.Second)), mockDelayed(start.Add(2 * time.Second))})
+}
+
+func benchmarkTimerQueues(b *testing.B, run func(b *testing.B, newQueue func() TimerQueue[mockDelayed])) {
+	start := time.Now()
+	b.Run("heap", func(b *testing.B) {
+		run(b, func() TimerQueue[mockDelayed] { return NewDelayQueue[mockDelayed](b.N) })
+	})
+	b.Run("wheel", func(b *testing.B) {
+		run(b, func() TimerQueue[mockDelayed] { return NewTimingWheel[mockDelayed](time.Millisecond, start) })
+	})
+}
+
+func timerItems(n int) []mockDelayed {
+	start := time.Now()
+	r := rand.New(rand.NewSource(1))
+	items := make([]mockDelayed, n)
+	for i := range items {
+		items[i] = mockDelayed(start.Add(time.Duration(r.Int63n(int64(time.Hour)))))
+	}
+	return items
+}
+
+func BenchmarkTimerQueueInsert(b *testing.B) {
+	benchmarkTimerQueues(b, func(b *testing.B, newQueue func() TimerQueue[mockDelayed]) {
+		items := timerItems(b.N)
+		q := newQueue()
+		b.ResetTimer()
+		for _, item := range items {
+			q.PushHandle(item)
+		}
+	})
+}
+
+func BenchmarkTimerQueueCancel(b *testing.B) {
+	benchmarkTimerQueues(b, func(b *testing.B, newQueue func() TimerQueue[mockDelayed]) {
+		items := timerItems(b.N)
+		q := newQueue()
+		handles := make([]*Handle, len(items))
+		for i, item := range items {
+			handles[i], _ = q.PushHandle(item)
+		}
+		b.ResetTimer()
+		for _, h := range handles {
+			q.Remove(h)
+		}
+	})
+}
+
+func BenchmarkTimerQueueFire(b *testing.B) {
+	benchmarkTimerQueues(b, func(b *testing.B, newQueue func() TimerQueue[mockDelayed]) {
+		items := timerItems(b.N)
+		q := newQueue()
+		for _, item := range items {
+			q.PushHandle(item)
+		}
+		b.ResetTimer()
+		drain(q)
+	})
+}
+
+type mockTimer struct {
+	deadline time.Time
+	name     string
+}
+
+func (m mockTimer) Deadline() time.Time {
+	return m.deadline
+}
+
+func TestTimingWheelStable(t *testing.T) {
+	start := time.Now()
+	tw := NewTimingWheel[mockTimer](time.Millisecond, start, Stable())
+	when := start.Add(time.Hour)
+	names := []string{"a", "b", "c", "d", "e"}
+	for _, name := range names {
+		tw.Push(mockTimer{deadline: when, name: name})
+	}
+
+	var got []string
+	for {
+		item, ok := tw.PopExpired(when)
+		if !ok {
+			break
+		}
+		got = append(got, item.name)
+	}
+	assert.DeepEqual(t, got, names)
+}
@@ -0,0 +1,193 @@
+package at
+
+import (
+	"math"
+	"time"
+)
+
+// tokenBucket allows rate events per second on average, and bursts of up to
+// burst events. Tokens are reserved ahead of time, which drives the count
+// negative; waiters then queue up one token interval apart.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// advance adds the tokens earned since the last call.
+func (b *tokenBucket) advance(now time.Time) {
+	elapsed := now.Sub(b.last)
+	// The first call, or a wall clock set back: start counting afresh.
+	if b.last.IsZero() || elapsed < 0 {
+		b.last = now
+		return
+	}
+	b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+	b.last = now
+}
+
+// wait returns how long from now until a token is free.
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	b.advance(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration(math.Ceil((1 - b.tokens) / b.rate * float64(time.Second)))
+}
+
+// rateLimit is the configuration of a token bucket.
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+// limiter holds the token buckets jobs are dispatched through.
+type limiter struct {
+	global *tokenBucket
+
+	queueLimits map[string]rateLimit
+	queues      map[string]*tokenBucket
+
+	labelLimits map[string]rateLimit
+	labels      map[[2]string]*tokenBucket
+}
+
+// buckets returns the token buckets e is dispatched through, creating them
+// as needed.
+func (l *limiter) buckets(e *entry) []*tokenBucket {
+	var bs []*tokenBucket
+	if l.global != nil {
+		bs = append(bs, l.global)
+	}
+
+	if limit, ok := l.queueLimits[e.Queue]; ok {
+		b, ok := l.queues[e.Queue]
+		if !ok {
+			b = newTokenBucket(limit.rate, limit.burst)
+			l.queues[e.Queue] = b
+		}
+		bs = append(bs, b)
+	}
+
+	for key, limit := range l.labelLimits {
+		value, ok := e.Labels[key]
+		if !ok {
+			continue
+		}
+		b, ok := l.labels[[2]string{key, value}]
+		if !ok {
+			b = newTokenBucket(limit.rate, limit.burst)
+			l.labels[[2]string{key, value}] = b
+		}
+		bs = append(bs, b)
+	}
+	return bs
+}
+
+// reserve takes a token from every bucket e is dispatched through and
+// returns when e may run, now or when the last of the tokens is earned, and
+// the buckets the tokens were taken from.
+func (l *limiter) reserve(e *entry, now time.Time) (time.Time, []*tokenBucket) {
+	bs := l.buckets(e)
+	var wait time.Duration
+	for _, b := range bs {
+		wait = max(wait, b.wait(now))
+	}
+	for _, b := range bs {
+		b.tokens--
+	}
+	return now.Add(wait), bs
+}
+
+// WithRateLimit limits the dispatch of all jobs to rate per second on
+// average, with bursts of up to burst jobs. Due jobs beyond the limit stay
+// pending, each moved to the time it will be dispatched. A non-positive rate
+// sets no limit.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(a *At) {
+		if rate <= 0 {
+			return
+		}
+		a.limits.global = newTokenBucket(rate, burst)
+	}
+}
+
+// WithQueueRateLimit limits the dispatch of the jobs in the named queue, as
+// WithRateLimit does for all jobs. The limits of an entry's queue, its
+// labels and the global limit all apply.
+func WithQueueRateLimit(queue string, rate float64, burst int) Option {
+	return func(a *At) {
+		if rate <= 0 {
+			return
+		}
+		if a.limits.queueLimits == nil {
+			a.limits.queueLimits = make(map[string]rateLimit)
+			a.limits.queues = make(map[string]*tokenBucket)
+		}
+		a.limits.queueLimits[queue] = rateLimit{rate: rate, burst: burst}
+	}
+}
+
+// WithLabelRateLimit limits the dispatch of the jobs carrying the label key,
+// as WithRateLimit does for all jobs, separately for each of its values: with
+// a "customer" key, each customer gets rate jobs per second.
+func WithLabelRateLimit(key string, rate float64, burst int) Option {
+	return func(a *At) {
+		if rate <= 0 {
+			return
+		}
+		if a.limits.labelLimits == nil {
+			a.limits.labelLimits = make(map[string]rateLimit)
+			a.limits.labels = make(map[[2]string]*tokenBucket)
+		}
+		a.limits.labelLimits[key] = rateLimit{rate: rate, burst: burst}
+	}
+}
+
+// throttle reserves the dispatch of e, due at now, against the rate limits.
+// If e must wait it is queued again at the time it may run, holding the
+// reserved tokens, and throttle returns its Rescheduled event and true. a.mu
+// must be held.
+func (a *At) throttle(e *entry, now time.Time) (Event, bool) {
+	if e.reservation != nil {
+		// Its tokens were reserved when it was throttled.
+		e.reservation = nil
+		return Event{}, false
+	}
+
+	t, bs := a.limits.reserve(e, now)
+	if !t.After(now) {
+		return Event{}, false
+	}
+
+	prev := e.At
+	e.At, e.due = t, prev
+	e.reservation = bs
+	handle, err := a.entries.PushHandle(e)
+	if err != nil {
+		// Without room to wait in, the entry runs at once.
+		e.At = prev
+		a.refund(e)
+		return Event{}, false
+	}
+	e.handle = handle
+	return Event{Type: Rescheduled, EntryID: e.ID, At: t, Previous: prev}, true
+}
+
+// refund gives back the tokens reserved by e, which no longer runs at the
+// time it reserved them for, and forgets the time it was due before. a.mu
+// must be held.
+func (a *At) refund(e *entry) {
+	for _, b := range e.reservation {
+		b.tokens = math.Min(b.burst, b.tokens+1)
+	}
+	e.reservation, e.due = nil, time.Time{}
+}
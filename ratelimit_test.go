@@ -0,0 +1,196 @@
+package at
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+func reserveAt(a *At, e *entry, now time.Time) time.Time {
+	t, _ := a.limits.reserve(e, now)
+	return t
+}
+
+func TestLimiterReserve(t *testing.T) {
+	a := New(WithRateLimit(10, 2), WithQueueRateLimit("mail", 1, 1), WithLabelRateLimit("customer", 5, 1))
+	now := time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)
+	plain := &entry{Queue: DefaultQueue}
+
+	// The burst goes at once, then one job every 100ms.
+	assert.DeepEqual(t, reserveAt(a, plain, now), now)
+	assert.DeepEqual(t, reserveAt(a, plain, now), now)
+	assert.DeepEqual(t, reserveAt(a, plain, now), now.Add(100*time.Millisecond))
+	assert.DeepEqual(t, reserveAt(a, plain, now), now.Add(200*time.Millisecond))
+	// Tokens are earned back over time.
+	later := now.Add(time.Second)
+	assert.DeepEqual(t, reserveAt(a, plain, later), later)
+
+	// The strictest of the limits that apply wins.
+	mail := &entry{Queue: "mail"}
+	later = later.Add(time.Second)
+	assert.DeepEqual(t, reserveAt(a, mail, later), later)
+	assert.DeepEqual(t, reserveAt(a, mail, later), later.Add(time.Second))
+
+	// Each label value has its own bucket.
+	later = later.Add(10 * time.Second)
+	acme := &entry{Queue: DefaultQueue, Labels: Labels{"customer": "acme"}}
+	initech := &entry{Queue: DefaultQueue, Labels: Labels{"customer": "initech"}}
+	assert.DeepEqual(t, reserveAt(a, acme, later), later)
+	assert.DeepEqual(t, reserveAt(a, initech, later), later)
+	assert.DeepEqual(t, reserveAt(a, acme, later), later.Add(200*time.Millisecond))
+}
+
+func TestRateLimitDispatch(t *testing.T) {
+	at := New(WithRateLimit(50, 1))
+	ran := make(chan time.Time, 10)
+	due := time.Now()
+	for i := 0; i < 10; i++ {
+		at.AddFunc(due, func() { ran <- time.Now() })
+	}
+
+	at.Start()
+	defer at.Stop()
+
+	first := <-ran
+	// The held back jobs are pending at their effective start times.
+	time.Sleep(10 * time.Millisecond)
+	pending := at.Entries()
+	assert.True(t, len(pending) > 0)
+	for i := 1; i < len(pending); i++ {
+		assert.True(t, pending[i].At.After(pending[i-1].At))
+	}
+
+	var last time.Time
+	for i := 1; i < 10; i++ {
+		select {
+		case last = <-ran:
+		case <-time.After(2 * time.Second):
+			t.Fatal("job did not run")
+		}
+	}
+	// Nine jobs one token interval apart.
+	assert.True(t, last.Sub(first) >= 150*time.Millisecond)
+}
+
+func TestRateLimitRefund(t *testing.T) {
+	at := New(WithRateLimit(1, 1))
+	sub := at.Subscribe(16)
+	defer sub.Close()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		at.AddFunc(start, func() {})
+	}
+	at.Start()
+	defer at.Stop()
+
+	// One job runs at once, the other three are held back a second apart.
+	for n := 0; n < 3; {
+		if nextEvent(t, sub).Type == Rescheduled {
+			n++
+		}
+	}
+
+	// Cancelling and rescheduling held back jobs gives their tokens back.
+	var pending []EntryID
+	for _, e := range at.Entries() {
+		pending = append(pending, e.ID)
+	}
+	assert.Len(t, pending, 3)
+	assert.True(t, at.Cancel(pending[0]))
+	assert.True(t, at.Cancel(pending[1]))
+	assert.True(t, at.Reschedule(pending[2], time.Now().Add(time.Hour)))
+
+	id, _ := at.AddFunc(time.Now(), func() {})
+	for {
+		ev := nextEvent(t, sub)
+		if ev.EntryID == id && (ev.Type == Rescheduled || ev.Type == Started) {
+			assert.True(t, ev.At.Before(start.Add(1500*time.Millisecond)))
+			break
+		}
+	}
+}
+
+func TestRateLimitBusyKey(t *testing.T) {
+	for _, policy := range []BusyPolicy{WaitWhenBusy, SkipWhenBusy, DelayWhenBusy} {
+		at := New(WithRateLimit(1, 2))
+		sub := at.Subscribe(16)
+		release := make(chan struct{})
+		started := make(chan struct{})
+		at.AddFunc(time.Now(), func() {
+			close(started)
+			<-release
+		}, WithConcurrencyKey("k", 1, WaitWhenBusy))
+
+		at.Start()
+		<-started
+
+		// The busy entry spends no token, so the last one is left for the
+		// plain entry due after it.
+		busy, _ := at.AddFunc(time.Now(), func() {}, WithConcurrencyKey("k", 1, policy), WithBusyDelay(time.Hour))
+		plain, _ := at.AddFunc(time.Now(), func() {})
+		for {
+			ev := nextEvent(t, sub)
+			if ev.EntryID == busy && ev.Type == Started {
+				t.Fatalf("policy %d: busy entry ran", policy)
+			}
+			if ev.EntryID == plain && (ev.Type == Rescheduled || ev.Type == Started) {
+				assert.DeepEqual(t, ev.Type, Started)
+				break
+			}
+		}
+
+		close(release)
+		at.Stop()
+		sub.Close()
+	}
+}
+
+func TestRateLimitLateness(t *testing.T) {
+	at := New(WithRateLimit(10, 1))
+	sub := at.Subscribe(16)
+	defer sub.Close()
+
+	due := time.Now()
+	at.AddFunc(due, func() {})
+	at.AddFunc(due, func() {})
+	at.Start()
+	defer at.Stop()
+	for n := 0; n < 2; {
+		if nextEvent(t, sub).Type == Succeeded {
+			n++
+		}
+	}
+
+	// The held back job counts from the time it was due.
+	at.metrics.mu.Lock()
+	defer at.metrics.mu.Unlock()
+	lateness := at.metrics.queue(DefaultQueue).lateness
+	assert.DeepEqual(t, lateness.count, uint64(2))
+	assert.True(t, lateness.sum >= 0.09)
+}
+
+func TestRateLimitMissed(t *testing.T) {
+	at := New(WithRateLimit(4, 1), WithMissedTolerance(100*time.Millisecond))
+	sub := at.Subscribe(16)
+	defer sub.Close()
+
+	due := time.Now()
+	first, _ := at.AddFunc(due, func() {})
+	second, _ := at.AddFunc(due, func() {})
+	at.Start()
+	defer at.Stop()
+
+	// Held back past the tolerance, the second job is missed.
+	for {
+		ev := nextEvent(t, sub)
+		if ev.Type == Missed {
+			assert.DeepEqual(t, ev.EntryID, second)
+			break
+		}
+		if ev.Type == Started {
+			assert.DeepEqual(t, ev.EntryID, first)
+		}
+	}
+}
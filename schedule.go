@@ -0,0 +1,167 @@
+package at
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrNoNextRun is returned when a recurring job is added with a schedule
+// that yields no future time.
+var ErrNoNextRun = errors.New("at: schedule has no next run")
+
+// Schedule describes a recurring job's duty cycle.
+type Schedule interface {
+	// Next returns the next time the job runs, later than t. A zero time
+	// means the job does not run again.
+	Next(t time.Time) time.Time
+}
+
+// intervalSchedule runs a job at a fixed interval.
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+// Every returns a Schedule that runs a job every d, starting d from now. A
+// non-positive d never runs.
+func Every(d time.Duration) Schedule {
+	return intervalSchedule{interval: d}
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	if s.interval <= 0 {
+		return time.Time{}
+	}
+	return t.Add(s.interval)
+}
+
+// daySchedule runs a job at a wall clock time every few days.
+type daySchedule struct {
+	days         int
+	hour, minute int
+}
+
+// EveryDays returns a Schedule that runs a job every n days at hour:minute,
+// in the time zone of the At. The first run is the next occurrence of
+// hour:minute.
+func EveryDays(n, hour, minute int) Schedule {
+	if n < 1 {
+		n = 1
+	}
+	return daySchedule{days: n, hour: hour, minute: minute}
+}
+
+func (s daySchedule) Next(t time.Time) time.Time {
+	y, m, d := t.Date()
+	next := time.Date(y, m, d, s.hour, s.minute, 0, 0, t.Location())
+	if next.After(t) {
+		return next
+	}
+
+	// Counting days on the calendar keeps the wall clock time across DST.
+	return time.Date(y, m, d+s.days, s.hour, s.minute, 0, 0, t.Location())
+}
+
+// listSchedule runs a job at each of a fixed set of times.
+type listSchedule []time.Time
+
+// Times returns a Schedule that runs a job once at each of the given times.
+// Times already past when the job is added are skipped.
+func Times(ts ...time.Time) Schedule {
+	s := make(listSchedule, len(ts))
+	copy(s, ts)
+	sort.Slice(s, func(i, j int) bool { return s[i].Before(s[j]) })
+	return s
+}
+
+func (s listSchedule) Next(t time.Time) time.Time {
+	i := sort.Search(len(s), func(i int) bool { return s[i].After(t) })
+	if i == len(s) {
+		return time.Time{}
+	}
+	return s[i]
+}
+
+// ScheduleFunc adds a func to the At to be run repeatedly on the given
+// schedule.
+func (a *At) ScheduleFunc(s Schedule, cmd func(), opts ...JobOption) (EntryID, error) {
+	return a.ScheduleJob(s, FuncJob(cmd), opts...)
+}
+
+// ScheduleJob adds a Job to the At to be run repeatedly on the given
+// schedule. The entry first runs at s.Next(now). After each run it is
+// requeued under the same id at the next time the schedule yields after the
+// run's scheduled time; runs that would have started while the job was still
+// running are skipped. Cancelling the entry, even while it runs, stops the
+// schedule.
+func (a *At) ScheduleJob(s Schedule, cmd Job, opts ...JobOption) (EntryID, error) {
+	t := s.Next(a.now())
+	if t.IsZero() {
+		return 0, ErrNoNextRun
+	}
+
+	e := &entry{
+		Job:      cmd,
+		At:       t,
+		Queue:    DefaultQueue,
+		Schedule: s,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return a.add(e)
+}
+
+// requeue makes a recurring entry pending again after it ran, unless it was
+// cancelled in the meantime or its schedule is exhausted. If the entry
+// cannot be added again, for instance because another entry took its key
+// while it ran, its schedule ends with a Cancelled event carrying the
+// reason. Either way the entries still waiting for its next run are
+// cancelled when the schedule ends.
+func (a *At) requeue(e *entry) {
+	now := a.now()
+	t := e.Schedule.Next(e.planned)
+	if !t.IsZero() && !t.After(now) {
+		t = e.Schedule.Next(now)
+	}
+
+	a.mu.Lock()
+	if a.recurring[e.ID] != e {
+		a.mu.Unlock()
+		return
+	}
+	if t.IsZero() {
+		delete(a.recurring, e.ID)
+		cancelled := a.settle(e.ID, outcomeNotRun)
+		a.mu.Unlock()
+
+		a.emitCancelled(cancelled)
+		return
+	}
+
+	next := &entry{}
+	*next = *e
+	next.At, next.planned = t, time.Time{}
+	next.handle, next.due = nil, time.Time{}
+	dropped, kept, err := a.insert(next)
+	if kept != 0 || err != nil {
+		if kept != 0 {
+			err = fmt.Errorf("%w: %q is held by entry %d", ErrDuplicateKey, e.Key, kept)
+		}
+		next.cancelErr = err
+		delete(a.recurring, e.ID)
+		cancelled := append([]*entry{next}, a.settle(e.ID, outcomeNotRun)...)
+		a.mu.Unlock()
+
+		a.emitCancelled(cancelled)
+		return
+	}
+	rescheduled := Event{Type: Rescheduled, EntryID: next.ID, At: next.At, Previous: e.At}
+	a.mu.Unlock()
+
+	a.notify()
+	a.emitCancelled(dropped)
+	a.emit(rescheduled)
+}
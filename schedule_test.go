@@ -0,0 +1,144 @@
+package at
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+func TestEvery(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	assert.DeepEqual(t, Every(time.Hour).Next(now), now.Add(time.Hour))
+	assert.True(t, Every(0).Next(now).IsZero())
+}
+
+func TestEveryDays(t *testing.T) {
+	s := EveryDays(2, 9, 30)
+
+	before := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	assert.DeepEqual(t, s.Next(before), time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC))
+
+	run := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	assert.DeepEqual(t, s.Next(run), time.Date(2024, 3, 3, 9, 30, 0, 0, time.UTC))
+
+	// The wall clock time is kept across the spring DST transition.
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	run = time.Date(2024, 3, 9, 9, 30, 0, 0, loc)
+	assert.DeepEqual(t, EveryDays(1, 9, 30).Next(run), time.Date(2024, 3, 10, 9, 30, 0, 0, loc))
+}
+
+func TestTimes(t *testing.T) {
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	s := Times(base.Add(2*time.Hour), base, base.Add(time.Hour))
+
+	assert.DeepEqual(t, s.Next(base.Add(-time.Minute)), base)
+	assert.DeepEqual(t, s.Next(base), base.Add(time.Hour))
+	assert.DeepEqual(t, s.Next(base.Add(90*time.Minute)), base.Add(2*time.Hour))
+	assert.True(t, s.Next(base.Add(2*time.Hour)).IsZero())
+}
+
+func TestScheduleRecurring(t *testing.T) {
+	at := New()
+	var runs int32
+	id, err := at.ScheduleFunc(Every(30*time.Millisecond), func() {
+		atomic.AddInt32(&runs, 1)
+	})
+	assert.Nil(t, err)
+
+	e, ok := at.Entry(id)
+	assert.True(t, ok)
+	assert.NotNil(t, e.Schedule)
+
+	at.Start()
+	defer at.Stop()
+	time.Sleep(200 * time.Millisecond)
+	assert.True(t, atomic.LoadInt32(&runs) >= 3)
+
+	// The entry keeps its id across runs until it is cancelled.
+	assert.True(t, at.Cancel(id))
+	n := atomic.LoadInt32(&runs)
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, atomic.LoadInt32(&runs) <= n+1)
+	_, ok = at.Entry(id)
+	assert.False(t, ok)
+}
+
+func TestScheduleFiniteList(t *testing.T) {
+	at := New()
+	now := time.Now()
+	var runs int32
+	id, err := at.ScheduleFunc(Times(now.Add(20*time.Millisecond), now.Add(40*time.Millisecond), now.Add(-time.Hour)), func() {
+		atomic.AddInt32(&runs, 1)
+	})
+	assert.Nil(t, err)
+
+	at.Start()
+	defer at.Stop()
+	time.Sleep(150 * time.Millisecond)
+	assert.DeepEqual(t, atomic.LoadInt32(&runs), int32(2))
+	_, ok := at.Entry(id)
+	assert.False(t, ok)
+	assert.False(t, at.Cancel(id))
+
+	_, err = at.ScheduleFunc(Times(now.Add(-time.Hour)), func() {})
+	assert.DeepEqual(t, err, ErrNoNextRun)
+}
+
+func TestScheduleCancelWhileRunning(t *testing.T) {
+	at := New()
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	id, _ := at.ScheduleFunc(Every(10*time.Millisecond), func() {
+		started <- struct{}{}
+		<-release
+	})
+
+	at.Start()
+	defer at.Stop()
+	<-started
+
+	assert.True(t, at.Cancel(id))
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, started, 0)
+	assert.Len(t, at.Entries(), 0)
+}
+
+func TestScheduleKeyTakenWhileRunning(t *testing.T) {
+	at := New()
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	id, _ := at.ScheduleFunc(Every(10*time.Millisecond), func() {
+		started <- struct{}{}
+		<-release
+	}, WithKey("sync", RejectDuplicate))
+
+	sub := at.Subscribe(16)
+	defer sub.Close()
+	at.Start()
+	defer at.Stop()
+	<-started
+
+	// The key is free while the recurring entry runs.
+	other, err := at.AddFunc(time.Now().Add(time.Hour), func() {}, WithKey("sync", RejectDuplicate))
+	assert.Nil(t, err)
+	close(release)
+
+	// The schedule cannot be requeued and ends with Cancelled.
+	for {
+		ev := nextEvent(t, sub)
+		if ev.Type == Cancelled {
+			assert.DeepEqual(t, ev.EntryID, id)
+			assert.True(t, errors.Is(ev.Err, ErrDuplicateKey))
+			break
+		}
+	}
+	got, _ := at.Key("sync")
+	assert.DeepEqual(t, got, other)
+}
@@ -0,0 +1,252 @@
+package at
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNonexistentTime is returned when a wall clock time that is skipped by a
+// DST transition is resolved under the GapReject policy.
+var ErrNonexistentTime = errors.New("at: wall clock time does not exist")
+
+// GapPolicy decides when a job runs whose wall clock time does not exist
+// because the clocks go forward, such as 02:30 on the night summer time
+// starts in most of Europe.
+type GapPolicy int
+
+const (
+	// GapAtTransition runs the job at the instant the clocks go forward, 03:00
+	// in the example.
+	GapAtTransition GapPolicy = iota
+	// GapShift moves the job forward by the length of the gap, 03:30 in the
+	// example.
+	GapShift
+	// GapReject refuses the time with ErrNonexistentTime.
+	GapReject
+)
+
+// OverlapPolicy decides when a job runs whose wall clock time occurs twice
+// because the clocks go back, such as 02:30 on the night summer time ends in
+// most of Europe.
+type OverlapPolicy int
+
+const (
+	// OverlapEarlier runs the job at the first occurrence, still in summer
+	// time.
+	OverlapEarlier OverlapPolicy = iota
+	// OverlapLater runs the job at the second occurrence, in standard time.
+	OverlapLater
+)
+
+// WallTime is a date and time of day as read from a clock in Location. Unlike
+// a time.Time it is an intention, "09:00 in Europe/Berlin", that is resolved
+// to an instant with the time zone rules in effect when it is resolved.
+type WallTime struct {
+	Year   int
+	Month  time.Month
+	Day    int
+	Hour   int
+	Minute int
+	Second int
+
+	Location *time.Location
+}
+
+// Wall returns the WallTime of the given date and time of day in loc.
+func Wall(year int, month time.Month, day, hour, minute, second int, loc *time.Location) WallTime {
+	return WallTime{
+		Year:     year,
+		Month:    month,
+		Day:      day,
+		Hour:     hour,
+		Minute:   minute,
+		Second:   second,
+		Location: loc,
+	}
+}
+
+func (w WallTime) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d %s", w.Year, w.Month, w.Day, w.Hour, w.Minute, w.Second, w.Location)
+}
+
+func (w *WallTime) clone() *WallTime {
+	if w == nil {
+		return nil
+	}
+	c := *w
+	return &c
+}
+
+// Resolve returns the instant the clock in w.Location reads w, using gap and
+// overlap when the time does not exist or occurs twice.
+func (w WallTime) Resolve(gap GapPolicy, overlap OverlapPolicy) (time.Time, error) {
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	naive := time.Date(w.Year, w.Month, w.Day, w.Hour, w.Minute, w.Second, 0, time.UTC)
+	guess := time.Date(w.Year, w.Month, w.Day, w.Hour, w.Minute, w.Second, 0, loc)
+
+	// A transition changes the offset at most once around the guess, so the
+	// offsets half a day either side are the only candidates.
+	var first, last, latest time.Time
+	for _, probe := range []time.Time{guess.Add(-12 * time.Hour), guess, guess.Add(12 * time.Hour)} {
+		_, offset := probe.Zone()
+		u := naive.Add(-time.Duration(offset) * time.Second).In(loc)
+		if latest.IsZero() || u.After(latest) {
+			latest = u
+		}
+		if !sameClock(u, naive) {
+			continue
+		}
+		if first.IsZero() || u.Before(first) {
+			first = u
+		}
+		if last.IsZero() || u.After(last) {
+			last = u
+		}
+	}
+
+	if !first.IsZero() {
+		if overlap == OverlapLater {
+			return last, nil
+		}
+		return first, nil
+	}
+
+	// The latest candidate is shifted forward by the gap, past the jump.
+	switch gap {
+	case GapShift:
+		return latest, nil
+	case GapReject:
+		return time.Time{}, fmt.Errorf("%w: %s", ErrNonexistentTime, w)
+	default:
+		start, _ := latest.ZoneBounds()
+		if start.IsZero() {
+			return latest, nil
+		}
+		return start.In(loc), nil
+	}
+}
+
+// sameClock reports whether t reads the date and time of day of naive.
+func sameClock(t, naive time.Time) bool {
+	y, m, d := t.Date()
+	h, mi, s := t.Clock()
+	ny, nm, nd := naive.Date()
+	nh, nmi, ns := naive.Clock()
+	return y == ny && m == nm && d == nd && h == nh && mi == nmi && s == ns
+}
+
+// WithGapPolicy sets when a wall clock entry runs if its time does not exist.
+// The default is GapAtTransition.
+func WithGapPolicy(p GapPolicy) JobOption {
+	return func(e *entry) {
+		e.gap = p
+	}
+}
+
+// WithOverlapPolicy sets when a wall clock entry runs if its time occurs
+// twice. The default is OverlapEarlier.
+func WithOverlapPolicy(p OverlapPolicy) JobOption {
+	return func(e *entry) {
+		e.overlap = p
+	}
+}
+
+// AddWallFunc adds a func to the At to be run when the clock in w.Location
+// reads w.
+func (a *At) AddWallFunc(w WallTime, cmd func(), opts ...JobOption) (EntryID, error) {
+	return a.AddWallJob(w, FuncJob(cmd), opts...)
+}
+
+// AddWallJob adds a Job to the At to be run when the clock in w.Location
+// reads w. The time is resolved when the entry is added, following the gap
+// and overlap policies, and again by ReloadTimeZones.
+func (a *At) AddWallJob(w WallTime, cmd Job, opts ...JobOption) (EntryID, error) {
+	e := &entry{
+		Job:   cmd,
+		Queue: DefaultQueue,
+		Wall:  &w,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	t, err := w.Resolve(e.gap, e.overlap)
+	if err != nil {
+		return 0, err
+	}
+	e.At = t
+	return a.add(e)
+}
+
+// ReloadTimeZones reloads the time zone of every pending wall clock entry
+// from the time zone database and resolves its time again, moving entries
+// whose time changed. Call it after the database is updated, for instance
+// when a country changes its DST rules. It returns the ids of the moved
+// entries, and the first error met; entries that fail keep their time.
+func (a *At) ReloadTimeZones() ([]EntryID, error) {
+	type move struct {
+		id       EntryID
+		at, prev time.Time
+	}
+
+	a.mu.Lock()
+	var (
+		moves    []move
+		firstErr error
+		zones    = make(map[string]*time.Location)
+	)
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, e := range a.index {
+		if e.Wall == nil || e.Wall.Location == nil {
+			continue
+		}
+
+		name := e.Wall.Location.String()
+		loc, ok := zones[name]
+		if !ok {
+			var err error
+			if loc, err = time.LoadLocation(name); err != nil {
+				fail(err)
+				continue
+			}
+			zones[name] = loc
+		}
+
+		w := *e.Wall
+		w.Location = loc
+		t, err := w.Resolve(e.gap, e.overlap)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if t.Equal(e.planned) {
+			e.Wall = &w
+			continue
+		}
+		moved, err := a.move(e, t, &w)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		moves = append(moves, move{id: e.ID, at: moved.At, prev: e.At})
+	}
+	a.mu.Unlock()
+
+	if len(moves) > 0 {
+		a.notify()
+	}
+	ids := make([]EntryID, 0, len(moves))
+	for _, m := range moves {
+		ids = append(ids, m.id)
+		a.emit(Event{Type: Rescheduled, EntryID: m.id, At: m.at, Previous: m.prev})
+	}
+	return ids, firstErr
+}
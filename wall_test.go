@@ -0,0 +1,88 @@
+package at
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotoxu/assert"
+)
+
+func TestWallResolve(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+
+	got, err := Wall(2024, time.June, 1, 9, 0, 0, berlin).Resolve(GapAtTransition, OverlapEarlier)
+	assert.Nil(t, err)
+	assert.True(t, got.Equal(time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC)))
+
+	// Summer time starts at 02:00 on 31 March 2024: 02:30 does not exist.
+	gap := Wall(2024, time.March, 31, 2, 30, 0, berlin)
+	got, err = gap.Resolve(GapAtTransition, OverlapEarlier)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got.Format("15:04 MST"), "03:00 CEST")
+	got, err = gap.Resolve(GapShift, OverlapEarlier)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got.Format("15:04 MST"), "03:30 CEST")
+	_, err = gap.Resolve(GapReject, OverlapEarlier)
+	assert.NotNil(t, err)
+
+	// Summer time ends at 03:00 on 27 October 2024: 02:30 occurs twice.
+	overlap := Wall(2024, time.October, 27, 2, 30, 0, berlin)
+	got, err = overlap.Resolve(GapAtTransition, OverlapEarlier)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got.Format("15:04 MST"), "02:30 CEST")
+	got, err = overlap.Resolve(GapAtTransition, OverlapLater)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got.Format("15:04 MST"), "02:30 CET")
+}
+
+func TestAddWallJob(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+	at := New()
+
+	id, err := at.AddWallFunc(Wall(2031, time.March, 30, 2, 30, 0, berlin), func() {}, WithGapPolicy(GapShift))
+	assert.Nil(t, err)
+	e, ok := at.Entry(id)
+	assert.True(t, ok)
+	assert.DeepEqual(t, e.At.In(berlin).Format("15:04 MST"), "03:30 CEST")
+	assert.DeepEqual(t, e.Wall.Hour, 2)
+
+	_, err = at.AddWallFunc(Wall(2031, time.March, 30, 2, 30, 0, berlin), func() {}, WithGapPolicy(GapReject))
+	assert.NotNil(t, err)
+
+	// Rescheduling to a fixed time drops the wall clock intention.
+	assert.True(t, at.Reschedule(id, time.Now().Add(time.Hour)))
+	e, _ = at.Entry(id)
+	assert.True(t, e.Wall == nil)
+}
+
+func TestReloadTimeZones(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+
+	// An outdated zone that still carries Berlin's name: reloading it picks
+	// up the real rules.
+	stale := time.FixedZone("Europe/Berlin", 0)
+	at := New()
+	id, err := at.AddWallFunc(Wall(2031, time.June, 1, 9, 0, 0, stale), func() {})
+	assert.Nil(t, err)
+	plain, _ := at.AddFunc(time.Now().Add(time.Hour), func() {})
+
+	sub := at.Subscribe(4)
+	defer sub.Close()
+
+	ids, err := at.ReloadTimeZones()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, ids, []EntryID{id})
+
+	e, _ := at.Entry(id)
+	assert.True(t, e.At.Equal(time.Date(2031, 6, 1, 9, 0, 0, 0, berlin)))
+	ev := nextEvent(t, sub)
+	assert.DeepEqual(t, ev.Type, Rescheduled)
+	assert.True(t, ev.Previous.Equal(time.Date(2031, 6, 1, 9, 0, 0, 0, time.UTC)))
+
+	p, _ := at.Entry(plain)
+	assert.True(t, p.Wall == nil)
+
+	ids, err = at.ReloadTimeZones()
+	assert.Nil(t, err)
+	assert.Len(t, ids, 0)
+}